@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowlistSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allowlist-sink")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	newSink := func() *savior.AllowlistSink {
+		return &savior.AllowlistSink{
+			Allowed: map[string]bool{
+				"a/b/ok.txt": true,
+				"top.txt":    true,
+			},
+			Sink: &savior.FolderSink{
+				Directory: dir,
+				Consumer:  &state.Consumer{},
+			},
+		}
+	}
+
+	extract := func(items []zipItem) error {
+		zipBytes := makeRawZip(t, items)
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetConsumer(&state.Consumer{})
+
+		_, err = ex.Resume(nil, newSink())
+		return err
+	}
+
+	// listed files, and the directories that lead to them
+	assert.NoError(t, extract([]zipItem{
+		{name: "a/", data: ""},
+		{name: "a/b/", data: ""},
+		{name: "a/b/ok.txt", data: "ok"},
+		{name: "top.txt", data: "ok"},
+	}))
+
+	isNotAllowed := func(err error) bool {
+		_, ok := savior.UnwrapError(err).(*savior.ErrPathNotAllowed)
+		return ok
+	}
+
+	assert.True(t, isNotAllowed(extract([]zipItem{
+		{name: "top.txt", data: "ok"},
+		{name: "sneaky.txt", data: "not listed"},
+	})))
+	assert.True(t, isNotAllowed(extract([]zipItem{
+		{name: "a/c/", data: ""},
+	})))
+
+	sink := newSink()
+	assert.True(t, isNotAllowed(sink.Symlink(&savior.Entry{
+		CanonicalPath: "a/link",
+		Kind:          savior.EntryKindSymlink,
+	}, "b/ok.txt")))
+
+	_, err = os.Stat(filepath.Join(dir, "sneaky.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeAppleDouble lays out an AppleDouble file the way macOS does: the
+// finder info entry is followed by the extended attributes, and the
+// resource fork comes last
+func makeAppleDouble(finderInfo []byte, resourceFork []byte, xattrName string, xattrValue []byte) []byte {
+	be := binary.BigEndian
+	const finderInfoOffset = 26 + 2*12
+	const attrHeaderOffset = finderInfoOffset + 32 + 2
+	const attrEntryOffset = attrHeaderOffset + 36
+
+	attrEntryLen := 11 + len(xattrName) + 1
+	valueOffset := attrEntryOffset + (attrEntryLen+3)&^3
+	resourceForkOffset := valueOffset + len(xattrValue)
+
+	buf := make([]byte, resourceForkOffset+len(resourceFork))
+	be.PutUint32(buf[0:], 0x00051607)
+	be.PutUint32(buf[4:], 0x00020000)
+	be.PutUint16(buf[24:], 2)
+
+	be.PutUint32(buf[26:], 9)
+	be.PutUint32(buf[30:], finderInfoOffset)
+	be.PutUint32(buf[34:], uint32(resourceForkOffset-finderInfoOffset))
+	be.PutUint32(buf[38:], 2)
+	be.PutUint32(buf[42:], uint32(resourceForkOffset))
+	be.PutUint32(buf[46:], uint32(len(resourceFork)))
+
+	copy(buf[finderInfoOffset:], finderInfo)
+
+	copy(buf[attrHeaderOffset:], "ATTR")
+	be.PutUint16(buf[attrHeaderOffset+34:], 1)
+	be.PutUint32(buf[attrEntryOffset:], uint32(valueOffset))
+	be.PutUint32(buf[attrEntryOffset+4:], uint32(len(xattrValue)))
+	buf[attrEntryOffset+10] = byte(len(xattrName) + 1)
+	copy(buf[attrEntryOffset+11:], xattrName)
+
+	copy(buf[valueOffset:], xattrValue)
+	copy(buf[resourceForkOffset:], resourceFork)
+	return buf
+}
+
+// appleDoubleRecordingSink pretends it can apply AppleDouble
+// metadata, and remembers what it was asked to apply
+type appleDoubleRecordingSink struct {
+	*savior.FolderSink
+	applied map[string]*savior.AppleDouble
+}
+
+func (ars *appleDoubleRecordingSink) CanApplyAppleDouble() bool {
+	return true
+}
+
+func (ars *appleDoubleRecordingSink) ApplyAppleDouble(canonicalPath string, ad *savior.AppleDouble) error {
+	_, err := ars.FileInfo(canonicalPath)
+	if err != nil {
+		return err
+	}
+	ars.applied[canonicalPath] = ad
+	return nil
+}
+
+func TestAppleDoubleTarget(t *testing.T) {
+	for _, tc := range []struct {
+		path   string
+		target string
+		ok     bool
+	}{
+		{"__MACOSX/._icon.png", "icon.png", true},
+		{"__MACOSX/App.app/Contents/._Info.plist", "App.app/Contents/Info.plist", true},
+		{"App.app/._Info.plist", "App.app/Info.plist", true},
+		{"App.app/Info.plist", "", false},
+		{"__MACOSX/", "", false},
+	} {
+		target, ok := savior.AppleDoubleTarget(tc.path)
+		assert.Equal(t, tc.ok, ok, tc.path)
+		assert.Equal(t, tc.target, target, tc.path)
+	}
+
+	_, err := savior.ParseAppleDouble([]byte("just a file that starts with a dot"))
+	assert.Error(t, err)
+}
+
+func TestZipAppleDoublePolicy(t *testing.T) {
+	finderInfo := []byte("APPLMACS")
+	finderInfo = append(finderInfo, make([]byte, 24)...)
+	appleDouble := makeAppleDouble(finderInfo, []byte("resource fork"), "com.apple.quarantine", []byte("0081;5e1f"))
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, item := range []struct {
+		name string
+		data []byte
+	}{
+		{"App.app/Contents/Info.plist", []byte("<plist/>")},
+		{"__MACOSX/", nil},
+		{"__MACOSX/App.app/Contents/._Info.plist", appleDouble},
+		{"__MACOSX/._missing.txt", appleDouble},
+	} {
+		w, err := zw.Create(item.name)
+		assert.NoError(t, err)
+		_, err = w.Write(item.data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	extract := func(policy savior.AppleDoublePolicy, makeSink func(dir string) savior.Sink) (string, *savior.ExtractorResult) {
+		dir, err := ioutil.TempDir("", "appledouble")
+		assert.NoError(t, err)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetConsumer(&state.Consumer{})
+		ex.SetAppleDoublePolicy(policy)
+
+		res, err := ex.Resume(nil, makeSink(dir))
+		assert.NoError(t, err)
+		return dir, res
+	}
+	folderSink := func(dir string) savior.Sink {
+		return &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}
+	}
+
+	// skipped
+	dir, res := extract(savior.AppleDoublePolicySkip, folderSink)
+	defer os.RemoveAll(dir)
+	_, err := os.Stat(filepath.Join(dir, "__MACOSX"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "App.app", "Contents", "Info.plist"))
+	assert.NoError(t, err)
+	for _, entry := range res.Entries {
+		if savior.IsAppleDoublePath(entry.CanonicalPath) {
+			assert.Equal(t, savior.EntryOutcomeSkipped, entry.Outcome, entry.CanonicalPath)
+		}
+	}
+
+	// applied
+	ars := &appleDoubleRecordingSink{applied: make(map[string]*savior.AppleDouble)}
+	dir, res = extract(savior.AppleDoublePolicyApply, func(dir string) savior.Sink {
+		ars.FolderSink = &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}
+		return ars
+	})
+	defer os.RemoveAll(dir)
+	_, err = os.Stat(filepath.Join(dir, "__MACOSX"))
+	assert.True(t, os.IsNotExist(err))
+	if ad, ok := ars.applied["App.app/Contents/Info.plist"]; assert.True(t, ok) {
+		assert.Equal(t, finderInfo, ad.FinderInfo)
+		assert.Equal(t, "resource fork", string(ad.ResourceFork))
+		assert.Equal(t, map[string][]byte{"com.apple.quarantine": []byte("0081;5e1f")}, ad.Xattrs)
+	}
+	for _, entry := range res.Entries {
+		switch entry.CanonicalPath {
+		case "__MACOSX/App.app/Contents/._Info.plist":
+			assert.Equal(t, savior.EntryOutcomeWritten, entry.Outcome)
+		case "__MACOSX/._missing.txt":
+			assert.Equal(t, savior.EntryOutcomeSkipped, entry.Outcome)
+		}
+	}
+
+	// sinks that can't apply them extract them instead
+	if runtime.GOOS != "darwin" {
+		dir, _ = extract(savior.AppleDoublePolicyApply, folderSink)
+		defer os.RemoveAll(dir)
+		data, err := ioutil.ReadFile(filepath.Join(dir, "__MACOSX", "App.app", "Contents", "._Info.plist"))
+		assert.NoError(t, err)
+		assert.Equal(t, appleDouble, data)
+	}
+}
@@ -0,0 +1,101 @@
+package archive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCASSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cas-sink")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a/", data: ""},
+		{name: "a/one.txt", data: "same contents"},
+		{name: "b/two.txt", data: "same contents"},
+		{name: "three.txt", data: "other contents"},
+	})
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+
+	sink := &savior.CASSink{
+		Directory:    filepath.Join(dir, "objects"),
+		ManifestPath: filepath.Join(dir, "manifest.jsonl"),
+	}
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err)
+
+	records, err := sink.Manifest()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	oneID, err := sink.ObjectID("a/one.txt")
+	assert.NoError(t, err)
+	twoID, err := sink.ObjectID("b/two.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, oneID, twoID, "identical files should be deduplicated")
+
+	sum := sha256.Sum256([]byte("same contents"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), oneID)
+
+	_, err = sink.ObjectID("a")
+	assert.Error(t, err, "directories aren't stored")
+}
+
+func TestCASSinkResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cas-sink")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &savior.CASSink{
+		Directory:    filepath.Join(dir, "objects"),
+		ManifestPath: filepath.Join(dir, "manifest.jsonl"),
+	}
+
+	entry := &savior.Entry{
+		CanonicalPath: "file.txt",
+		Kind:          savior.EntryKindFile,
+	}
+
+	w, err := sink.GetWriter(entry)
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Sync())
+	// as if we crashed: written too much, and never closed
+	_, err = w.Write([]byte("garbage"))
+	assert.NoError(t, err)
+
+	resumed := &savior.Entry{
+		CanonicalPath: "file.txt",
+		Kind:          savior.EntryKindFile,
+		WriteOffset:   5,
+	}
+	w, err = sink.GetWriter(resumed)
+	assert.NoError(t, err)
+	_, err = w.Write([]byte(" world"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	id, err := sink.ObjectID("file.txt")
+	assert.NoError(t, err)
+	sum := sha256.Sum256([]byte("hello world"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), id)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "objects", id[:2], id))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(contents))
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoordinator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coordinator")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var lastProgress float64
+	c := &savior.Coordinator{
+		MaxConcurrent: 2,
+		Consumer: &state.Consumer{
+			OnProgress: func(alpha float64) {
+				lastProgress = alpha
+			},
+		},
+	}
+
+	archives := [][]zipItem{
+		{{name: "base/a.txt", data: "aaaa"}},
+		{{name: "dlc1/b.txt", data: "bb"}, {name: "dlc1/c.txt", data: "c"}},
+		{{name: "dlc2/d.txt", data: "dddddddd"}},
+	}
+	for _, items := range archives {
+		zipBytes := makeRawZip(t, items)
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+
+		var size int64
+		for _, entry := range ex.List() {
+			size += entry.UncompressedSize
+		}
+
+		c.Jobs = append(c.Jobs, &savior.ExtractionJob{
+			Extractor: ex,
+			Sink: &savior.FolderSink{
+				Directory: dir,
+				Consumer:  &state.Consumer{},
+			},
+			Size: size,
+		})
+	}
+
+	res, err := c.Run()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, countEntries(res, savior.EntryKindFile))
+	assert.InDelta(t, 1.0, lastProgress, 0.0001)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dlc2", "d.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dddddddd", string(data))
+}
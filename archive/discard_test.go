@@ -0,0 +1,57 @@
+package archive
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/seeksource"
+	"github.com/itchio/savior/semirandom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscard(t *testing.T) {
+	data := semirandom.Bytes(64 * 1024)
+
+	for _, discard := range []func(savior.Source, int64) error{savior.Discard, savior.DiscardByRead} {
+		source := seeksource.FromBytes(data)
+		_, err := source.Resume(nil)
+		assert.NoError(t, err)
+
+		assert.NoError(t, discard(source, 1000))
+		assert.NoError(t, discard(source, 234))
+		assert.EqualValues(t, 1234, source.Tell())
+
+		rest, err := ioutil.ReadAll(source)
+		assert.NoError(t, err)
+		assert.EqualValues(t, data[1234:], rest)
+	}
+}
+
+func benchmarkDiscard(b *testing.B, discard func(savior.Source, int64) error) {
+	const size = 64 * 1024 * 1024
+	data := make([]byte, size)
+	source := seeksource.FromBytes(data)
+
+	b.SetBytes(size - 1)
+	for i := 0; i < b.N; i++ {
+		_, err := source.Resume(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		// as if resuming near the end of a large stored entry
+		err = discard(source, size-1)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDiscardByRead(b *testing.B) {
+	benchmarkDiscard(b, savior.DiscardByRead)
+}
+
+func BenchmarkDiscardBySeek(b *testing.B) {
+	benchmarkDiscard(b, savior.Discard)
+}
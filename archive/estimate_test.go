@@ -0,0 +1,63 @@
+// +build cgo,!js
+
+package archive
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/itchio/wharf/compressors/cbrotli"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingReader counts how many bytes were read from it
+type countingReader struct {
+	r     io.Reader
+	count int64
+}
+
+func (cr *countingReader) Read(buf []byte) (int, error) {
+	n, err := cr.r.Read(buf)
+	cr.count += int64(n)
+	return n, err
+}
+
+func TestEstimateCompression(t *testing.T) {
+	const size = 4 * 1024 * 1024
+	const quality = 1
+
+	compressible := []byte(strings.Repeat("the same old song and dance\n", size/28))
+	random := make([]byte, size)
+	rand.New(rand.NewSource(0xb407)).Read(random)
+
+	estimate := func(data []byte, sampleSize int64) (float64, int64) {
+		cr := &countingReader{r: bytes.NewReader(data)}
+		ratio, err := cbrotli.EstimateCompression(cr, quality, sampleSize)
+		assert.NoError(t, err)
+		return ratio, cr.count
+	}
+
+	compressibleRatio, _ := estimate(compressible, 0)
+	randomRatio, _ := estimate(random, 0)
+	assert.True(t, compressibleRatio < 0.1, "repetitive text should compress well, got %f", compressibleRatio)
+	assert.True(t, randomRatio > 0.95, "random data shouldn't compress, got %f", randomRatio)
+	assert.True(t, compressibleRatio < randomRatio)
+
+	// nothing past the sample is read
+	const sampleSize = 1024 * 1024
+	_, read := estimate(random, sampleSize)
+	assert.EqualValues(t, sampleSize, read)
+
+	// so a compressible start hides what comes after it
+	mixed := append(append([]byte{}, compressible[:sampleSize]...), random[:size-sampleSize]...)
+	sampledRatio, _ := estimate(mixed, sampleSize)
+	fullRatio, _ := estimate(mixed, 0)
+	assert.True(t, sampledRatio < fullRatio, "sampled %f should look better than full %f", sampledRatio, fullRatio)
+
+	// empty input doesn't compress at all
+	emptyRatio, _ := estimate(nil, 0)
+	assert.EqualValues(t, 1, emptyRatio)
+}
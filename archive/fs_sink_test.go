@@ -0,0 +1,175 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// memFS is an in-memory savior.WritableFS, without symlinks
+type memFS struct {
+	mutex sync.Mutex
+	dirs  map[string]bool
+	files map[string][]byte
+}
+
+func newMemFS() *memFS {
+	return &memFS{
+		dirs:  make(map[string]bool),
+		files: make(map[string][]byte),
+	}
+}
+
+func (mfs *memFS) MkdirAll(name string, perm os.FileMode) error {
+	mfs.mutex.Lock()
+	defer mfs.mutex.Unlock()
+
+	for name != "." && name != "/" {
+		mfs.dirs[name] = true
+		name = path.Dir(name)
+	}
+	return nil
+}
+
+func (mfs *memFS) OpenFile(name string, flag int, perm os.FileMode) (savior.WritableFile, error) {
+	mfs.mutex.Lock()
+	defer mfs.mutex.Unlock()
+
+	if _, ok := mfs.files[name]; !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+		mfs.files[name] = nil
+	}
+	return &memFile{fs: mfs, name: name}, nil
+}
+
+func (mfs *memFS) RemoveAll(name string) error {
+	mfs.mutex.Lock()
+	defer mfs.mutex.Unlock()
+
+	inside := func(k string) bool {
+		return name == "." || k == name || strings.HasPrefix(k, name+"/")
+	}
+	for k := range mfs.dirs {
+		if inside(k) {
+			delete(mfs.dirs, k)
+		}
+	}
+	for k := range mfs.files {
+		if inside(k) {
+			delete(mfs.files, k)
+		}
+	}
+	return nil
+}
+
+type memFile struct {
+	fs     *memFS
+	name   string
+	offset int64
+}
+
+func (mf *memFile) Write(buf []byte) (int, error) {
+	mf.fs.mutex.Lock()
+	defer mf.fs.mutex.Unlock()
+
+	data := mf.fs.files[mf.name]
+	if end := mf.offset + int64(len(buf)); end > int64(len(data)) {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	copy(data[mf.offset:], buf)
+	mf.fs.files[mf.name] = data
+	mf.offset += int64(len(buf))
+	return len(buf), nil
+}
+
+func (mf *memFile) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart {
+		return 0, os.ErrInvalid
+	}
+	mf.offset = offset
+	return offset, nil
+}
+
+func (mf *memFile) Truncate(size int64) error {
+	mf.fs.mutex.Lock()
+	defer mf.fs.mutex.Unlock()
+
+	data := mf.fs.files[mf.name]
+	if size < int64(len(data)) {
+		data = data[:size]
+	} else {
+		data = append(data, make([]byte, size-int64(len(data)))...)
+	}
+	mf.fs.files[mf.name] = data
+	return nil
+}
+
+func (mf *memFile) Close() error {
+	return nil
+}
+
+// appendOnlyFile can't seek
+type appendOnlyFile struct {
+	io.Writer
+}
+
+func (aof *appendOnlyFile) Close() error { return nil }
+
+type appendOnlyFS struct {
+	*memFS
+}
+
+func (aofs *appendOnlyFS) OpenFile(name string, flag int, perm os.FileMode) (savior.WritableFile, error) {
+	f, err := aofs.memFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &appendOnlyFile{Writer: f}, nil
+}
+
+func TestFSSink(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "empty/", data: ""},
+		{name: "data/level.dat", data: strings.Repeat("level data ", 100)},
+		{name: "readme.txt", data: "hello"},
+	})
+
+	mfs := newMemFS()
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+
+	sink := &savior.FSSink{
+		FS:       mfs,
+		Root:     "game",
+		Consumer: &state.Consumer{},
+	}
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err)
+
+	assert.True(t, mfs.dirs["game/empty"])
+	assert.Equal(t, strings.Repeat("level data ", 100), string(mfs.files["game/data/level.dat"]))
+	assert.Equal(t, "hello", string(mfs.files["game/readme.txt"]))
+
+	// symlinks are skipped, not an error
+	assert.NoError(t, sink.Symlink(&savior.Entry{CanonicalPath: "link"}, "readme.txt"))
+
+	assert.NoError(t, sink.Nuke())
+	assert.Empty(t, mfs.files)
+
+	// files that can't seek can't be resumed in the middle
+	aosink := &savior.FSSink{FS: &appendOnlyFS{newMemFS()}}
+	_, err = aosink.GetWriter(&savior.Entry{CanonicalPath: "a.txt", Kind: savior.EntryKindFile, WriteOffset: 4})
+	assert.Error(t, err)
+}
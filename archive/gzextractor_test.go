@@ -0,0 +1,241 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/checker"
+	"github.com/itchio/savior/gzextractor"
+	"github.com/itchio/savior/gzipsource"
+	"github.com/itchio/savior/seeksource"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGzExtractor(t *testing.T) {
+	contents := strings.Repeat("a compressed log line\n", 1000)
+
+	makeGz := func(name string) []byte {
+		buf := new(bytes.Buffer)
+		gw := gzip.NewWriter(buf)
+		gw.Name = name
+		_, err := gw.Write([]byte(contents))
+		assert.NoError(t, err)
+		assert.NoError(t, gw.Close())
+		return buf.Bytes()
+	}
+
+	extract := func(gzBytes []byte, archiveName string) string {
+		dir, err := ioutil.TempDir("", "gzextractor-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		ex := gzextractor.New(seeksource.FromBytes(gzBytes), archiveName)
+		ex.SetConsumer(&state.Consumer{})
+		res, err := ex.Resume(nil, &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+		assert.NoError(t, err)
+		if !assert.Len(t, res.Entries, 1) {
+			return ""
+		}
+
+		entry := res.Entries[0]
+		assert.EqualValues(t, len(contents), entry.UncompressedSize)
+		written, err := ioutil.ReadFile(filepath.Join(dir, entry.CanonicalPath))
+		assert.NoError(t, err)
+		assert.Equal(t, contents, string(written))
+		return entry.CanonicalPath
+	}
+
+	assert.Equal(t, "original.log", extract(makeGz("original.log"), "renamed.log.gz"))
+	assert.Equal(t, "renamed.log", extract(makeGz(""), "renamed.log.gz"))
+	assert.Equal(t, "evil.log", extract(makeGz("../../evil.log"), "renamed.log.gz"))
+}
+
+func TestGzExtractorResume(t *testing.T) {
+	data := make([]byte, 8*1024*1024)
+	rng := rand.New(rand.NewSource(0xf00d))
+	for i := range data {
+		data[i] = "abcdefgh"[rng.Intn(8)]
+	}
+
+	sink := checker.NewSink()
+	sink.Items["big.bin"] = &checker.Item{
+		Entry: &savior.Entry{
+			CanonicalPath: "big.bin",
+			Kind:          savior.EntryKindFile,
+		},
+		Data: data,
+	}
+
+	gzBytes, err := checker.GzipCompress(data)
+	assert.NoError(t, err)
+
+	makeExtractor := func() savior.Extractor {
+		return gzextractor.New(seeksource.FromBytes(gzBytes), "big.bin.gz")
+	}
+	checker.RunExtractorText(t, makeExtractor, sink, func() bool {
+		return rng.Intn(2) == 0
+	})
+}
+
+func TestGzExtractorMultistream(t *testing.T) {
+	data := make([]byte, 8*1024*1024)
+	rng := rand.New(rand.NewSource(0xbeef))
+	for i := range data {
+		data[i] = "abcdefgh"[rng.Intn(8)]
+	}
+
+	// like pigz or `cat a.gz b.gz c.gz d.gz`
+	var gzBytes []byte
+	memberSize := len(data) / 4
+	for i := 0; i < len(data); i += memberSize {
+		member, err := checker.GzipCompress(data[i : i+memberSize])
+		assert.NoError(t, err)
+		gzBytes = append(gzBytes, member...)
+	}
+
+	sink := checker.NewSink()
+	sink.Items["big.bin"] = &checker.Item{
+		Entry: &savior.Entry{
+			CanonicalPath: "big.bin",
+			Kind:          savior.EntryKindFile,
+		},
+		Data: data,
+	}
+
+	makeExtractor := func() savior.Extractor {
+		return gzextractor.New(seeksource.FromBytes(gzBytes), "big.bin.gz")
+	}
+	checker.RunExtractorText(t, makeExtractor, sink, func() bool {
+		return rng.Intn(2) == 0
+	})
+}
+
+func TestGzipSourceMultistreamResume(t *testing.T) {
+	data := make([]byte, 2*1024*1024)
+	rng := rand.New(rand.NewSource(0xcafe))
+	for i := range data {
+		data[i] = "abcdefgh"[rng.Intn(8)]
+	}
+
+	var gzBytes []byte
+	memberSize := len(data) / 4
+	for i := 0; i < len(data); i += memberSize {
+		member, err := checker.GzipCompress(data[i : i+memberSize])
+		assert.NoError(t, err)
+		gzBytes = append(gzBytes, member...)
+	}
+
+	src := gzipsource.New(seeksource.FromBytes(gzBytes))
+	_, err := src.Resume(nil)
+	assert.NoError(t, err)
+
+	var checkpoints []*savior.SourceCheckpoint
+	src.SetSourceSaveConsumer(&savior.CallbackSourceSaveConsumer{
+		OnSave: func(checkpoint *savior.SourceCheckpoint) error {
+			checkpoints = append(checkpoints, checkpoint)
+			return nil
+		},
+	})
+
+	buf := make([]byte, 16*1024)
+	for {
+		src.WantSave()
+		_, err := src.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+	}
+
+	// checkpoints in later members must resume where they were
+	// made, not from the start of the stream
+	laterMembers := 0
+	for _, checkpoint := range checkpoints {
+		if checkpoint.Data.(*gzipsource.GzipSourceCheckpoint).MemberOffset == 0 {
+			continue
+		}
+		laterMembers++
+
+		resumed := gzipsource.New(seeksource.FromBytes(gzBytes))
+		offset, err := resumed.Resume(checkpoint)
+		assert.NoError(t, err)
+		assert.EqualValues(t, checkpoint.Offset, offset)
+
+		rest, err := ioutil.ReadAll(resumed)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(data[offset:], rest), "data after resuming @ %d should match", offset)
+	}
+	assert.True(t, laterMembers > 0, "should have checkpoints in later members")
+}
+
+// inlineStopper saves checkpoints next to the output, and stops
+// extraction after the first one
+type inlineStopper struct {
+	savior.InlineSaveConsumer
+	saved bool
+}
+
+func (is *inlineStopper) Save(checkpoint *savior.ExtractorCheckpoint) (savior.AfterSaveAction, error) {
+	_, err := is.InlineSaveConsumer.Save(checkpoint)
+	if err != nil {
+		return savior.AfterSaveContinue, err
+	}
+	is.saved = true
+	return savior.AfterSaveStop, nil
+}
+
+func TestGzExtractorInlineCheckpoint(t *testing.T) {
+	data := make([]byte, 4*1024*1024)
+	rng := rand.New(rand.NewSource(0xd00d))
+	for i := range data {
+		data[i] = "abcdefgh"[rng.Intn(8)]
+	}
+	gzBytes, err := checker.GzipCompress(data)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "gzextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	outputPath := filepath.Join(dir, "big.bin")
+	sink := &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}
+
+	ex := gzextractor.New(seeksource.FromBytes(gzBytes), "big.bin.gz")
+	ex.SetConsumer(&state.Consumer{})
+	stopper := &inlineStopper{InlineSaveConsumer: savior.InlineSaveConsumer{OutputPath: outputPath}}
+	ex.SetSaveConsumer(stopper)
+
+	_, err = ex.Resume(nil, sink)
+	assert.Equal(t, savior.ErrStop, err)
+	assert.True(t, stopper.saved)
+
+	// resuming only needs the output path
+	checkpoint, err := savior.ReadInlineCheckpoint(outputPath)
+	assert.NoError(t, err)
+	if assert.NotNil(t, checkpoint) {
+		assert.True(t, checkpoint.Entry.WriteOffset > 0)
+	}
+
+	ex = gzextractor.New(seeksource.FromBytes(gzBytes), "big.bin.gz")
+	ex.SetConsumer(&state.Consumer{})
+	_, err = ex.Resume(checkpoint, sink)
+	assert.NoError(t, err)
+
+	written, err := ioutil.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, written), "resumed output should match")
+
+	assert.NoError(t, savior.ClearInlineCheckpoint(outputPath))
+	checkpoint, err = savior.ReadInlineCheckpoint(outputPath)
+	assert.NoError(t, err)
+	assert.Nil(t, checkpoint)
+}
@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/stretchr/testify/assert"
+)
+
+// specialFileInfo is a named pipe
+type specialFileInfo struct {
+	fakeFileInfo
+}
+
+func (sfi specialFileInfo) Mode() os.FileMode {
+	return os.ModeNamedPipe | 0644
+}
+
+func TestWindowsLinkStrategy(t *testing.T) {
+	// what's tried first
+	assert.Equal(t, savior.LinkMethodFile, savior.WindowsLinkStrategyFile.LinkMethod())
+	assert.Equal(t, savior.LinkMethodSymlink, savior.WindowsLinkStrategySymlink.LinkMethod())
+	assert.Equal(t, savior.LinkMethodJunction, savior.WindowsLinkStrategyJunction.LinkMethod())
+	assert.Equal(t, savior.LinkMethodSymlink, savior.WindowsLinkStrategyAuto.LinkMethod())
+	assert.Equal(t, savior.LinkMethodFile, savior.WindowsLinkStrategy(42).LinkMethod())
+
+	// what auto falls back to, depending on the target
+	dir, err := ioutil.TempDir("", "link-strategy")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("target"), 0644))
+
+	stat := func(path string) os.FileInfo {
+		stats, err := os.Stat(path)
+		assert.NoError(t, err)
+		return stats
+	}
+
+	assert.Equal(t, savior.LinkMethodJunction, savior.AutoLinkFallback(stat(dir)))
+	assert.Equal(t, savior.LinkMethodCopy, savior.AutoLinkFallback(stat(file)))
+	assert.Equal(t, savior.LinkMethodFile, savior.AutoLinkFallback(nil))
+	assert.Equal(t, savior.LinkMethodFile, savior.AutoLinkFallback(specialFileInfo{}))
+
+	assert.Equal(t, "junction", savior.LinkMethodJunction.String())
+	assert.Equal(t, "auto", savior.WindowsLinkStrategyAuto.String())
+}
+
+func TestFolderSinkLinkTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "link-target")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "a"), 0755))
+	assert.NoError(t, os.MkdirAll(outside, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "a", "b.txt"), []byte("inside"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+
+	link := &savior.Entry{CanonicalPath: "a/link", Kind: savior.EntryKindSymlink}
+
+	isOutside := func(err error) bool {
+		_, ok := err.(*savior.ErrOutsideRoot)
+		return ok
+	}
+
+	for _, strategy := range []savior.WindowsLinkStrategy{
+		savior.WindowsLinkStrategyFile,
+		savior.WindowsLinkStrategySymlink,
+		savior.WindowsLinkStrategyJunction,
+		savior.WindowsLinkStrategyAuto,
+	} {
+		sink := &savior.FolderSink{Directory: root, WindowsLinkStrategy: strategy}
+
+		target, err := sink.LinkTarget(link, "b.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(root, "a", "b.txt"), target)
+
+		_, err = sink.LinkTarget(link, "../../outside/secret.txt")
+		assert.True(t, isOutside(err), "%s: ../ targets are outside", strategy)
+		_, err = sink.LinkTarget(link, filepath.Join(outside, "secret.txt"))
+		assert.True(t, isOutside(err), "%s: absolute targets are outside", strategy)
+		_, err = sink.LinkTarget(link, "C:/Users/x/secret")
+		assert.True(t, isOutside(err), "%s: drive letters are outside", strategy)
+
+		// whatever gets created, it's never a copy of, or a junction
+		// to, something outside of the root
+		err = sink.Symlink(link, "../../outside/secret.txt")
+		if err != nil {
+			assert.True(t, isOutside(savior.UnwrapError(err)), "%s: %v", strategy, err)
+		}
+		stats, err := os.Lstat(filepath.Join(root, "a", "link"))
+		if err == nil {
+			assert.False(t, stats.IsDir(), "%s: no junction", strategy)
+			if stats.Mode().IsRegular() {
+				data, err := ioutil.ReadFile(filepath.Join(root, "a", "link"))
+				assert.NoError(t, err)
+				assert.NotEqual(t, "secret", string(data), "%s: no copy", strategy)
+			}
+		}
+		os.RemoveAll(filepath.Join(root, "a", "link"))
+	}
+
+	if runtime.GOOS != "windows" {
+		// symlinks already on disk are followed
+		assert.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+		sink := &savior.FolderSink{Directory: root}
+		_, err := sink.LinkTarget(link, "../escape/secret.txt")
+		assert.True(t, isOutside(err))
+	}
+}
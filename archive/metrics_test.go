@@ -0,0 +1,147 @@
+package archive
+
+import (
+	"bytes"
+	"expvar"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordedEntry struct {
+	kind    savior.EntryKind
+	outcome savior.EntryOutcome
+	written int64
+}
+
+// recordingMetrics remembers every event it gets
+type recordingMetrics struct {
+	entries []recordedEntry
+	resumes int
+	written int64
+	done    int
+}
+
+var _ savior.Metrics = (*recordingMetrics)(nil)
+
+func (rm *recordingMetrics) EntryDone(kind savior.EntryKind, outcome savior.EntryOutcome, written int64, duration time.Duration) {
+	rm.entries = append(rm.entries, recordedEntry{kind, outcome, written})
+}
+
+func (rm *recordingMetrics) Resumed() {
+	rm.resumes++
+}
+
+func (rm *recordingMetrics) ArchiveDone(written int64, duration time.Duration) {
+	rm.written += written
+	rm.done++
+}
+
+func TestZipMetrics(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0x5eed)).Read(data)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "big.bin", data: string(data)},
+		{name: "small.txt", data: "small"},
+		{name: "d/", data: ""},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-metrics")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	extract := func(checkpoint *savior.ExtractorCheckpoint, sc savior.SaveConsumer, skipUnchanged bool) (*recordingMetrics, error) {
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetConsumer(&state.Consumer{})
+		ex.SetSaveConsumer(sc)
+		ex.SetCompareStrategy(zipextractor.CompareSizeAndCRC)
+		ex.SetSkipUnchanged(skipUnchanged)
+		m := &recordingMetrics{}
+		ex.SetMetrics(m)
+		_, err = ex.Resume(checkpoint, &savior.FolderSink{Directory: dir})
+		return m, err
+	}
+
+	// stop in the middle of big.bin
+	sc := &stopAfterSaves{saves: 2}
+	_, err = extract(nil, sc, false)
+	assert.Equal(t, savior.ErrStop, err)
+	resumeOffset := sc.checkpoint.Entry.WriteOffset
+	assert.True(t, resumeOffset > 0 && resumeOffset < int64(len(data)))
+
+	// only what's written after resuming counts
+	m, err := extract(sc.checkpoint, savior.NopSaveConsumer(), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m.resumes)
+	assert.Equal(t, 1, m.done)
+	assert.EqualValues(t, []recordedEntry{
+		{savior.EntryKindFile, savior.EntryOutcomeWritten, int64(len(data)) - resumeOffset},
+		{savior.EntryKindFile, savior.EntryOutcomeWritten, int64(len("small"))},
+		{savior.EntryKindDir, savior.EntryOutcomeWritten, 0},
+	}, m.entries)
+	assert.EqualValues(t, int64(len(data))-resumeOffset+int64(len("small")), m.written)
+
+	// entries that are already there don't count at all
+	m, err = extract(nil, savior.NopSaveConsumer(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, m.resumes)
+	assert.EqualValues(t, []recordedEntry{
+		{savior.EntryKindFile, savior.EntryOutcomeAlreadyPresent, 0},
+		{savior.EntryKindFile, savior.EntryOutcomeAlreadyPresent, 0},
+		{savior.EntryKindDir, savior.EntryOutcomeWritten, 0},
+	}, m.entries)
+	assert.EqualValues(t, 0, m.written)
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	em := savior.NewExpvarMetrics("archive-test-metrics")
+	vars := expvar.Get("archive-test-metrics").(*expvar.Map)
+
+	em.EntryDone(savior.EntryKindFile, savior.EntryOutcomeWritten, 1000, 5*time.Millisecond)
+	em.EntryDone(savior.EntryKindFile, savior.EntryOutcomeWritten, 100*1024, 2*time.Second)
+	em.EntryDone(savior.EntryKindFile, savior.EntryOutcomeWritten, 1024*1024*1024, 5*time.Minute)
+	em.EntryDone(savior.EntryKindFile, savior.EntryOutcomeAlreadyPresent, 0, time.Millisecond)
+	em.EntryDone(savior.EntryKindDir, savior.EntryOutcomeWritten, 0, time.Millisecond)
+	em.Resumed()
+	em.ArchiveDone(1000, 2*time.Second)
+
+	get := func(m *expvar.Map, key string) string {
+		v := m.Get(key)
+		if v == nil {
+			return "<nil>"
+		}
+		return v.String()
+	}
+
+	assert.Equal(t, "4", get(vars, "entries.file"))
+	assert.Equal(t, "1", get(vars, "entries.dir"))
+	assert.Equal(t, "1", get(vars, "resumes"))
+	assert.Equal(t, "1", get(vars, "archives"))
+	assert.Equal(t, "1073845224", get(vars, "bytesWritten"))
+	assert.Equal(t, "500", get(vars, "lastThroughput"))
+
+	// only written files land in the histograms
+	sizes := vars.Get("entrySize").(*expvar.Map)
+	assert.Equal(t, "1", get(sizes, "4096"))
+	assert.Equal(t, "0", get(sizes, "65536"))
+	assert.Equal(t, "1", get(sizes, "1048576"))
+	assert.Equal(t, "0", get(sizes, "16777216"))
+	assert.Equal(t, "0", get(sizes, "268435456"))
+	assert.Equal(t, "1", get(sizes, "+Inf"))
+
+	durations := vars.Get("entryDuration").(*expvar.Map)
+	assert.Equal(t, "1", get(durations, "0.01"))
+	assert.Equal(t, "0", get(durations, "0.1"))
+	assert.Equal(t, "0", get(durations, "1"))
+	assert.Equal(t, "1", get(durations, "10"))
+	assert.Equal(t, "0", get(durations, "60"))
+	assert.Equal(t, "1", get(durations, "+Inf"))
+}
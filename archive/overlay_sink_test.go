@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverlaySink(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "same.txt", data: "from the base layer"},
+		{name: "changed.txt", data: "new contents"},
+		{name: "added.txt", data: "brand new"},
+	})
+
+	dir, err := ioutil.TempDir("", "overlay-sink")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	lowerDir := filepath.Join(dir, "lower")
+	upperDir := filepath.Join(dir, "upper")
+	assert.NoError(t, os.MkdirAll(lowerDir, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(lowerDir, "same.txt"), []byte("from the base layer"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(lowerDir, "changed.txt"), []byte("old contents"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(lowerDir, "base-only.txt"), []byte("untouched"), 0644))
+
+	sink := &savior.OverlaySink{
+		Lower: &savior.FolderSink{Directory: lowerDir, Consumer: &state.Consumer{}},
+		Upper: &savior.FolderSink{Directory: upperDir, Consumer: &state.Consumer{}},
+	}
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetCompareStrategy(zipextractor.CompareSizeAndCRC)
+	ex.SetSkipUnchanged(true)
+
+	res, err := ex.Resume(nil, sink)
+	assert.NoError(t, err)
+
+	outcomes := make(map[string]savior.EntryOutcome)
+	for _, entry := range res.Entries {
+		outcomes[entry.CanonicalPath] = entry.Outcome
+	}
+	assert.Equal(t, savior.EntryOutcomeAlreadyPresent, outcomes["same.txt"])
+	assert.Equal(t, savior.EntryOutcomeWritten, outcomes["changed.txt"])
+	assert.Equal(t, savior.EntryOutcomeWritten, outcomes["added.txt"])
+
+	// identical files aren't written to the upper layer at all
+	_, err = os.Stat(filepath.Join(upperDir, "same.txt"))
+	assert.True(t, os.IsNotExist(err))
+	data, err := ioutil.ReadFile(filepath.Join(upperDir, "changed.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new contents", string(data))
+
+	// the base layer is left alone
+	data, err = ioutil.ReadFile(filepath.Join(lowerDir, "changed.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "old contents", string(data))
+	_, err = os.Stat(filepath.Join(lowerDir, "added.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// the overlay shows the upper layer's files over the lower layer's
+	files, err := sink.ListFiles()
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"added.txt", "base-only.txt", "changed.txt", "same.txt"}, files)
+
+	diff, err := ex.Diff(sink)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"same.txt", "changed.txt", "added.txt"}, diff.Unchanged)
+
+	assert.NoError(t, sink.Nuke())
+	_, err = os.Stat(filepath.Join(lowerDir, "same.txt"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,169 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// serialSink hides the ConcurrentPreallocateSink capability
+// of the sink it wraps
+type serialSink struct {
+	savior.Sink
+}
+
+func makeSmallEntries(n int) []*savior.Entry {
+	var entries []*savior.Entry
+	for i := 0; i < n; i++ {
+		entries = append(entries, &savior.Entry{
+			CanonicalPath:    fmt.Sprintf("dir%d/file%d.dat", i%64, i),
+			Kind:             savior.EntryKindFile,
+			Mode:             0644,
+			UncompressedSize: 4096,
+		})
+	}
+	return entries
+}
+
+func benchmarkPreallocate(b *testing.B, wrap func(sink savior.Sink) savior.Sink) {
+	entries := makeSmallEntries(2000)
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		dir, err := ioutil.TempDir("", "preallocate-bench")
+		if err != nil {
+			b.Fatal(err)
+		}
+		sink := wrap(&savior.FolderSink{
+			Directory: dir,
+			Consumer:  savior.NopConsumer(),
+		})
+		b.StartTimer()
+
+		err = savior.PreallocateEntries(sink, entries)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		os.RemoveAll(dir)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkPreallocateSerial(b *testing.B) {
+	benchmarkPreallocate(b, func(sink savior.Sink) savior.Sink {
+		return &serialSink{sink}
+	})
+}
+
+func BenchmarkPreallocateParallel(b *testing.B) {
+	benchmarkPreallocate(b, func(sink savior.Sink) savior.Sink {
+		return sink
+	})
+}
+
+// sparseVetoSink doesn't preallocate .sparse files
+type sparseVetoSink struct {
+	*savior.FolderSink
+}
+
+func (ss *sparseVetoSink) Preallocate(entry *savior.Entry) error {
+	if strings.HasSuffix(entry.CanonicalPath, ".sparse") {
+		return errors.Wrap(savior.ErrSkipPreallocate, 0)
+	}
+	return ss.FolderSink.Preallocate(entry)
+}
+
+func TestPreallocateSkip(t *testing.T) {
+	entries := makeSmallEntries(4)
+	entries[1].CanonicalPath += ".sparse"
+
+	for _, wrap := range []func(sink savior.Sink) savior.Sink{
+		func(sink savior.Sink) savior.Sink { return sink },
+		func(sink savior.Sink) savior.Sink { return &serialSink{sink} },
+	} {
+		dir, err := ioutil.TempDir("", "preallocate-skip")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		sink := &sparseVetoSink{&savior.FolderSink{
+			Directory: dir,
+			Consumer:  savior.NopConsumer(),
+		}}
+		assert.NoError(t, savior.PreallocateEntries(wrap(sink), entries))
+
+		for i, entry := range entries {
+			stats, err := os.Stat(filepath.Join(dir, filepath.FromSlash(entry.CanonicalPath)))
+			if i == 1 {
+				assert.True(t, os.IsNotExist(err), "vetoed entry shouldn't be preallocated")
+				continue
+			}
+			if assert.NoError(t, err) {
+				assert.EqualValues(t, 4096, stats.Size())
+			}
+		}
+	}
+}
+
+// preallocRecordingSink remembers which entries it was asked to preallocate
+type preallocRecordingSink struct {
+	*savior.FolderSink
+	preallocated []string
+}
+
+func (prs *preallocRecordingSink) Preallocate(entry *savior.Entry) error {
+	prs.preallocated = append(prs.preallocated, entry.CanonicalPath)
+	return prs.FolderSink.Preallocate(entry)
+}
+
+func TestZipPreallocateThreshold(t *testing.T) {
+	big := strings.Repeat("large file\n", 1024)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "small.txt", data: "tiny"},
+		{name: "big.txt", data: big},
+	})
+
+	for _, tc := range []struct {
+		threshold    int64
+		preallocated []string
+	}{
+		{0, []string{"small.txt", "big.txt"}},
+		{1024, []string{"big.txt"}},
+	} {
+		dir, err := ioutil.TempDir("", "preallocate-threshold")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetConsumer(&state.Consumer{})
+		ex.SetPreallocateThreshold(tc.threshold)
+
+		sink := &preallocRecordingSink{FolderSink: &savior.FolderSink{
+			Directory: dir,
+			Consumer:  savior.NopConsumer(),
+		}}
+		_, err = ex.Resume(nil, &serialSink{sink})
+		assert.NoError(t, err)
+		assert.EqualValues(t, tc.preallocated, sink.preallocated, "with threshold %d", tc.threshold)
+
+		// files that weren't preallocated are still extracted
+		data, err := ioutil.ReadFile(filepath.Join(dir, "small.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "tiny", string(data))
+		data, err = ioutil.ReadFile(filepath.Join(dir, "big.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, big, string(data))
+	}
+}
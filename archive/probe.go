@@ -5,14 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/itchio/butler/archive/szextractor"
-	"github.com/itchio/savior/bzip2source"
-	"github.com/itchio/savior/gzipsource"
-	"github.com/itchio/savior/seeksource"
-
 	"github.com/go-errors/errors"
-	"github.com/itchio/savior/tarextractor"
-	"github.com/itchio/savior/zipextractor"
 
 	"github.com/itchio/savior"
 	"github.com/itchio/wharf/eos"
@@ -31,6 +24,8 @@ const (
 	ArchiveStrategyTarBz2 ArchiveStrategy = 202
 
 	ArchiveStrategySevenZip ArchiveStrategy = 300
+
+	ArchiveStrategyGz ArchiveStrategy = 400
 )
 
 type ArchiveInfo struct {
@@ -57,8 +52,8 @@ func Probe(params *TryOpenParams) (*ArchiveInfo, error) {
 	}
 
 	info.Features = ex.Features()
-	if szex, ok := ex.(szextractor.SzExtractor); ok {
-		info.Format = szex.GetFormat()
+	if format, ok := szFormat(ex); ok {
+		info.Format = format
 	} else {
 		info.Format = info.Strategy.String()
 	}
@@ -73,23 +68,23 @@ func getStrategy(file eos.File, consumer *state.Consumer) ArchiveStrategy {
 		return ArchiveStrategyNone
 	}
 
-	lowerName := strings.ToLower(stats.Name())
+	return strategyForName(stats.Name(), consumer)
+}
+
+// strategyForName picks a strategy from a file name's extension
+func strategyForName(name string, consumer *state.Consumer) ArchiveStrategy {
+	lowerName := strings.ToLower(name)
 	ext := filepath.Ext(lowerName)
 	if strings.HasSuffix(lowerName, ".tar"+ext) {
 		ext = ".tar" + ext
 	}
 
-	switch ext {
-	case ".zip":
-		return ArchiveStrategyZip
-	case ".tar":
-		return ArchiveStrategyTar
-	case ".tar.gz":
-		return ArchiveStrategyTarGz
-	case ".tar.bz2":
-		return ArchiveStrategyTarBz2
-	case ".7z", ".rar", ".dmg", ".exe":
-		return ArchiveStrategySevenZip
+	for _, info := range registry {
+		for _, claimed := range info.Extensions {
+			if ext == claimed {
+				return info.Strategy
+			}
+		}
 	}
 
 	consumer.Warnf("archive: Unrecognized extension (%s), deferring to 7-zip", ext)
@@ -97,43 +92,16 @@ func getStrategy(file eos.File, consumer *state.Consumer) ArchiveStrategy {
 }
 
 func (ai *ArchiveInfo) GetExtractor(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
-	switch ai.Strategy {
-	case ArchiveStrategyZip:
-		stats, err := file.Stat()
-		if err != nil {
-			return nil, errors.Wrap(err, 0)
-		}
-
-		ex, err := zipextractor.New(file, stats.Size())
-		if err != nil {
-			return nil, errors.Wrap(err, 0)
-		}
-		return ex, nil
-	case ArchiveStrategyTar:
-		return tarextractor.New(seeksource.FromFile(file)), nil
-	case ArchiveStrategyTarGz:
-		return tarextractor.New(gzipsource.New(seeksource.FromFile(file))), nil
-	case ArchiveStrategyTarBz2:
-		return tarextractor.New(bzip2source.New(seeksource.FromFile(file))), nil
-	case ArchiveStrategySevenZip:
-		szex, err := szextractor.New(file, consumer)
-		if err != nil {
-			return nil, errors.Wrap(err, 0)
-		}
-
-		// apply blacklist
-		switch szex.GetFormat() {
-		// cf. https://github.com/itchio/itch/issues/1700
-		case "ELF":
-			return nil, fmt.Errorf("won't extract ELF executable")
-		case "PE":
-			return nil, fmt.Errorf("won't extract PE executable")
-		default:
-			return szex, nil
-		}
+	info, ok := registry[ai.Strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown ArchiveStrategy %d", ai.Strategy)
 	}
 
-	return nil, fmt.Errorf("unknown ArchiveStrategy %d", ai.Strategy)
+	ex, err := info.open(file, consumer)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return ex, nil
 }
 
 var (
@@ -142,6 +110,9 @@ var (
 		ArchiveStrategyTarBz2: "tar.bz2",
 		ArchiveStrategyTarGz:  "tar.gz",
 		ArchiveStrategyZip:    "zip",
+		ArchiveStrategyGz:     "gz",
+
+		ArchiveStrategySevenZip: "7z",
 	}
 )
 
@@ -21,6 +21,7 @@ var (
 		{"foo_bar.tar", ArchiveStrategyTar},
 		{"foo_bar.tar.gz", ArchiveStrategyTarGz},
 		{"foo_bar.tar.bz2", ArchiveStrategyTarBz2},
+		{"foo_bar.log.gz", ArchiveStrategyGz},
 		{"foo_bar.7z", ArchiveStrategySevenZip},
 		{"foo_bar.rar", ArchiveStrategySevenZip},
 		{"foo_bar.dmg", ArchiveStrategySevenZip},
@@ -94,3 +95,31 @@ func (ffi fakeFileInfo) Mode() os.FileMode {
 func (ffi fakeFileInfo) Sys() interface{} {
 	return nil
 }
+
+func TestExtractors(t *testing.T) {
+	byStrategy := make(map[ArchiveStrategy]ExtractorInfo)
+	for _, info := range Extractors() {
+		byStrategy[info.Strategy] = info
+	}
+
+	for _, strategy := range []ArchiveStrategy{
+		ArchiveStrategyZip,
+		ArchiveStrategyTar,
+		ArchiveStrategyTarGz,
+		ArchiveStrategyTarBz2,
+		ArchiveStrategyGz,
+	} {
+		info, ok := byStrategy[strategy]
+		if assert.True(t, ok, "%s should always be available", strategy) {
+			assert.NotEmpty(t, info.Extensions)
+			assert.NotEmpty(t, info.Features.Name)
+		}
+	}
+
+	// every extension maps back to the backend that claims it
+	for _, info := range Extractors() {
+		for _, ext := range info.Extensions {
+			assert.Equal(t, info.Strategy, strategyForName("foo_bar"+ext, &state.Consumer{}))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package archive
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/bzip2source"
+	"github.com/itchio/savior/gzextractor"
+	"github.com/itchio/savior/gzipsource"
+	"github.com/itchio/savior/seeksource"
+	"github.com/itchio/savior/tarextractor"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/eos"
+	"github.com/itchio/wharf/state"
+)
+
+// An ExtractorInfo describes one of the extractor backends
+// this build of butler can use
+type ExtractorInfo struct {
+	Strategy ArchiveStrategy
+	// Extensions are the file name extensions it claims, like ".tar.gz"
+	Extensions []string
+	// Features are those of a typical archive, some of them depend on
+	// the archive itself: see ArchiveInfo.Features once it's probed
+	Features savior.ExtractorFeatures
+
+	open func(file eos.File, consumer *state.Consumer) (savior.Extractor, error)
+	// available is nil for backends that are always available
+	available func() bool
+}
+
+var registry = make(map[ArchiveStrategy]*ExtractorInfo)
+
+func registerExtractor(info *ExtractorInfo) {
+	if _, ok := registry[info.Strategy]; ok {
+		panic(fmt.Sprintf("archive: extractor for %s registered twice", info.Strategy))
+	}
+	registry[info.Strategy] = info
+}
+
+// Extractors lists the extractor backends that can be used right now,
+// by strategy. Backends that need a native library are only listed
+// if it loads.
+func Extractors() []ExtractorInfo {
+	var res []ExtractorInfo
+	for _, info := range registry {
+		if info.available != nil && !info.available() {
+			continue
+		}
+		res = append(res, *info)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Strategy < res[j].Strategy
+	})
+	return res
+}
+
+func init() {
+	registerExtractor(&ExtractorInfo{
+		Strategy:   ArchiveStrategyZip,
+		Extensions: []string{".zip"},
+		Features: savior.ExtractorFeatures{
+			Name:          "zip",
+			ResumeSupport: savior.ResumeSupportBlock,
+			Preallocate:   true,
+			RandomAccess:  true,
+		},
+		open: func(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
+			stats, err := file.Stat()
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+
+			ex, err := zipextractor.New(file, stats.Size())
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+			return ex, nil
+		},
+	})
+
+	tarFeatures := tarextractor.New(nil).Features()
+	registerExtractor(&ExtractorInfo{
+		Strategy:   ArchiveStrategyTar,
+		Extensions: []string{".tar"},
+		Features:   tarFeatures,
+		open: func(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
+			return tarextractor.New(seeksource.FromFile(file)), nil
+		},
+	})
+	registerExtractor(&ExtractorInfo{
+		Strategy:   ArchiveStrategyTarGz,
+		Extensions: []string{".tar.gz"},
+		Features:   tarFeatures,
+		open: func(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
+			return tarextractor.New(gzipsource.New(seeksource.FromFile(file))), nil
+		},
+	})
+	registerExtractor(&ExtractorInfo{
+		Strategy:   ArchiveStrategyTarBz2,
+		Extensions: []string{".tar.bz2"},
+		Features:   tarFeatures,
+		open: func(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
+			return tarextractor.New(bzip2source.New(seeksource.FromFile(file))), nil
+		},
+	})
+
+	registerExtractor(&ExtractorInfo{
+		Strategy:   ArchiveStrategyGz,
+		Extensions: []string{".gz"},
+		Features:   gzextractor.New(nil, "").Features(),
+		open: func(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
+			stats, err := file.Stat()
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+
+			return gzextractor.New(seeksource.FromFile(file), stats.Name()), nil
+		},
+	})
+
+	registerExtractor(&ExtractorInfo{
+		Strategy: ArchiveStrategySevenZip,
+		// 7-zip is also tried for anything we don't recognize
+		Extensions: []string{".7z", ".rar", ".dmg", ".exe"},
+		Features: savior.ExtractorFeatures{
+			Name:          "sz",
+			ResumeSupport: savior.ResumeSupportEntry,
+			Preallocate:   true,
+			RandomAccess:  true,
+		},
+		open: func(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
+			szex, err := newSzExtractor(file, consumer)
+			if err != nil {
+				return nil, errors.Wrap(err, 0)
+			}
+
+			format, _ := szFormat(szex)
+
+			// apply blacklist
+			switch format {
+			// cf. https://github.com/itchio/itch/issues/1700
+			case "ELF":
+				return nil, fmt.Errorf("won't extract ELF executable")
+			case "PE":
+				return nil, fmt.Errorf("won't extract PE executable")
+			default:
+				return szex, nil
+			}
+		},
+		available: szAvailable,
+	})
+}
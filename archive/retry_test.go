@@ -0,0 +1,234 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyJitter(t *testing.T) {
+	rp := &savior.RetryPolicy{
+		MaxAttempts: 10,
+		Backoff:     100 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+	assert.EqualValues(t, 400*time.Millisecond, rp.Delay(2))
+	assert.EqualValues(t, time.Second, rp.Delay(8))
+
+	rp.Jitter = true
+	for i := 0; i < 100; i++ {
+		delay := rp.Delay(8)
+		assert.True(t, delay >= 0 && delay <= time.Second, "jittered delay %s out of range", delay)
+	}
+}
+
+func TestRetryPolicyDeadline(t *testing.T) {
+	rp := &savior.RetryPolicy{
+		MaxAttempts: 10,
+		Backoff:     100 * time.Millisecond,
+	}
+	assert.False(t, rp.PastDeadline(time.Hour), "no deadline by default")
+
+	rp.MaxElapsed = time.Second
+	assert.False(t, rp.PastDeadline(500*time.Millisecond))
+	assert.True(t, rp.PastDeadline(1500*time.Millisecond))
+
+	var nilPolicy *savior.RetryPolicy
+	assert.False(t, nilPolicy.PastDeadline(time.Hour))
+}
+
+// flakySink's writers fail with err for `failures` writes, once
+// `after` writes have gone through
+type flakySink struct {
+	*savior.FolderSink
+	after    int
+	failures int
+	err      error
+	writes   int
+}
+
+func (fs *flakySink) GetWriter(entry *savior.Entry) (savior.EntryWriter, error) {
+	w, err := fs.FolderSink.GetWriter(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyWriter{EntryWriter: w, sink: fs}, nil
+}
+
+type flakyWriter struct {
+	savior.EntryWriter
+	sink *flakySink
+}
+
+func (fw *flakyWriter) Write(buf []byte) (int, error) {
+	fw.sink.writes++
+	if fw.sink.writes > fw.sink.after && fw.sink.writes <= fw.sink.after+fw.sink.failures {
+		return 0, fw.sink.err
+	}
+	return fw.EntryWriter.Write(buf)
+}
+
+func TestZipRetryClock(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "eventually"},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-retry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &manualClock{now: start}
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetClock(clock)
+	// long enough that the test would time out if it really waited
+	ex.SetRetryPolicy(&savior.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     time.Hour,
+	})
+
+	_, err = ex.Resume(nil, &flakySink{
+		FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+		failures:   2,
+		err:        syscall.EAGAIN,
+	})
+	assert.NoError(t, err)
+
+	// waited an hour, then two, on the extractor's clock
+	assert.Equal(t, 3*time.Hour, clock.Now().Sub(start))
+}
+
+func TestZipRetry(t *testing.T) {
+	var big bytes.Buffer
+	for i := 0; big.Len() < 4*1024*1024; i++ {
+		fmt.Fprintf(&big, "line %d\n", i)
+	}
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "big.txt", data: big.String()},
+		{name: "small.txt", data: "small"},
+	})
+
+	extract := func(sink *flakySink) (*savior.ExtractorResult, []string, error) {
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		var warnings []string
+		ex.SetConsumer(&state.Consumer{
+			OnMessage: func(lvl string, msg string) {
+				if lvl == "warning" {
+					warnings = append(warnings, msg)
+				}
+			},
+		})
+		ex.SetClock(&manualClock{})
+		ex.SetRetryPolicy(&savior.RetryPolicy{
+			MaxAttempts: 5,
+			Backoff:     100 * time.Millisecond,
+		})
+		res, err := ex.Resume(nil, sink)
+		return res, warnings, err
+	}
+
+	// transient errors in the middle of big.txt, after some of it was
+	// written, are retried, and the entry ends up intact
+	dir, err := ioutil.TempDir("", "zipextractor-retry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{
+		FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+		after:      2,
+		failures:   3,
+		err:        syscall.EAGAIN,
+	}
+	res, warnings, err := extract(sink)
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 3)
+	assert.EqualValues(t, 2, len(res.Entries))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "big.txt"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(big.Bytes(), data), "big.txt should be intact after retrying")
+	data, err = ioutil.ReadFile(filepath.Join(dir, "small.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "small", string(data))
+
+	// permanent errors aren't
+	permanentDir, err := ioutil.TempDir("", "zipextractor-retry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(permanentDir)
+
+	sink = &flakySink{
+		FolderSink: &savior.FolderSink{Directory: permanentDir, Consumer: &state.Consumer{}},
+		failures:   1,
+		err:        fmt.Errorf("disk on fire"),
+	}
+	_, warnings, err = extract(sink)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "disk on fire")
+	assert.Empty(t, warnings)
+	assert.Equal(t, 1, sink.writes)
+}
+
+func TestZipRetryWithoutCheckpoints(t *testing.T) {
+	var big bytes.Buffer
+	for i := 0; big.Len() < 4*1024*1024; i++ {
+		fmt.Fprintf(&big, "line %d\n", i)
+	}
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "big.txt", data: big.String()},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-retry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	var warnings []string
+	ex.SetConsumer(&state.Consumer{
+		OnMessage: func(lvl string, msg string) {
+			if lvl == "warning" {
+				warnings = append(warnings, msg)
+			}
+		},
+	})
+	ex.SetClock(&manualClock{})
+	ex.SetRetryPolicy(&savior.RetryPolicy{
+		MaxAttempts: 5,
+		Backoff:     100 * time.Millisecond,
+	})
+	// transformed entries are copied without checkpoints
+	ex.SetContentTransform(func(entry *savior.Entry) bool {
+		return true
+	}, func(r io.Reader) io.Reader {
+		return r
+	})
+
+	// so after failing halfway through, they start over
+	_, err = ex.Resume(nil, &flakySink{
+		FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+		after:      2,
+		failures:   2,
+		err:        syscall.EAGAIN,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 2)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "big.txt"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(big.Bytes(), data), "big.txt should be intact after starting over")
+}
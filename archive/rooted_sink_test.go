@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/checker"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRootedSink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks aren't created on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "rooted-sink")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	assert.NoError(t, os.MkdirAll(root, 0755))
+	assert.NoError(t, os.MkdirAll(outside, 0755))
+
+	sink := &savior.RootedSink{
+		Root: root,
+		Sink: &savior.FolderSink{
+			Directory: root,
+			Consumer:  &state.Consumer{},
+		},
+	}
+
+	file := func(canonicalPath string) *savior.Entry {
+		return &savior.Entry{
+			CanonicalPath: canonicalPath,
+			Kind:          savior.EntryKindFile,
+			Mode:          0644,
+		}
+	}
+
+	isOutside := func(err error) bool {
+		_, ok := err.(*savior.ErrOutsideRoot)
+		return ok
+	}
+
+	// regular files and symlinks within the root are fine
+	w, err := sink.GetWriter(file("a/b.txt"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, sink.Symlink(file("a/link"), "b.txt"))
+
+	// lexical escapes
+	_, err = sink.GetWriter(file("../evil.txt"))
+	assert.True(t, isOutside(err))
+	assert.True(t, isOutside(sink.Symlink(file("a/evil-link"), "../../outside")))
+	assert.True(t, isOutside(sink.Symlink(file("a/abs-link"), outside)))
+
+	// a symlink that was already on disk can't be written through
+	assert.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+	_, err = sink.GetWriter(file("escape/evil.txt"))
+	assert.True(t, isOutside(err))
+	assert.True(t, isOutside(sink.Mkdir(&savior.Entry{
+		CanonicalPath: "escape/dir",
+		Kind:          savior.EntryKindDir,
+	})))
+
+	entries, err := ioutil.ReadDir(outside)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRootedSinkCapabilities(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "same.txt", data: "already there"},
+		{name: "changed.txt", data: "new contents"},
+	})
+
+	dir, err := ioutil.TempDir("", "rooted-sink-caps")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "same.txt"), []byte("already there"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "changed.txt"), []byte("old contents"), 0644))
+
+	sink := &savior.RootedSink{
+		Root: dir,
+		Sink: &savior.FolderSink{
+			Directory: dir,
+			Consumer:  &state.Consumer{},
+		},
+	}
+
+	// wrapping a FolderSink doesn't hide what it can do
+	_, ok := savior.AsInspectableSink(sink)
+	assert.True(t, ok)
+	_, ok = savior.AsDirSyncingSink(sink)
+	assert.True(t, ok)
+	ads, ok := savior.AsAppleDoubleSink(sink)
+	assert.True(t, ok)
+	assert.EqualValues(t, (&savior.FolderSink{}).CanApplyAppleDouble(), ads.CanApplyAppleDouble())
+
+	// ..but doesn't make up capabilities either
+	_, ok = savior.AsVerifyingSink(sink)
+	assert.False(t, ok)
+	_, ok = savior.AsSpecialFileSink(sink)
+	assert.False(t, ok)
+
+	checkerRooted := &savior.RootedSink{Root: dir, Sink: checker.NewSink()}
+	_, ok = savior.AsInspectableSink(checkerRooted)
+	assert.False(t, ok)
+	_, ok = savior.AsDirSyncingSink(checkerRooted)
+	assert.False(t, ok)
+	assert.False(t, checkerRooted.CanApplyAppleDouble())
+	assert.Error(t, checkerRooted.SyncDir("."))
+
+	// forwarded calls are still confined to the root
+	info, err := sink.FileInfo("same.txt")
+	assert.NoError(t, err)
+	assert.EqualValues(t, len("already there"), info.Size())
+	_, err = sink.FileInfo("../outside.txt")
+	_, isOutside := err.(*savior.ErrOutsideRoot)
+	assert.True(t, isOutside)
+	_, err = sink.OpenFile("../outside.txt")
+	_, isOutside = err.(*savior.ErrOutsideRoot)
+	assert.True(t, isOutside)
+	assert.NoError(t, sink.SyncDir("."))
+
+	// and extractors see through the wrapper
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetCompareStrategy(zipextractor.CompareSizeAndCRC)
+	ex.SetSkipUnchanged(true)
+
+	res, err := ex.Resume(nil, sink)
+	assert.NoError(t, err)
+
+	outcomes := make(map[string]savior.EntryOutcome)
+	for _, entry := range res.Entries {
+		outcomes[entry.CanonicalPath] = entry.Outcome
+	}
+	assert.Equal(t, savior.EntryOutcomeAlreadyPresent, outcomes["same.txt"])
+	assert.Equal(t, savior.EntryOutcomeWritten, outcomes["changed.txt"])
+}
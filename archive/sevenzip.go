@@ -0,0 +1,25 @@
+// +build !js
+
+package archive
+
+import (
+	"github.com/itchio/butler/archive/szextractor"
+	"github.com/itchio/savior"
+	"github.com/itchio/wharf/eos"
+	"github.com/itchio/wharf/state"
+)
+
+func newSzExtractor(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
+	return szextractor.New(file, consumer)
+}
+
+func szFormat(ex savior.Extractor) (string, bool) {
+	if szex, ok := ex.(szextractor.SzExtractor); ok {
+		return szex.GetFormat(), true
+	}
+	return "", false
+}
+
+func szAvailable() bool {
+	return szextractor.Available() == nil
+}
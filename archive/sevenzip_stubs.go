@@ -0,0 +1,27 @@
+// +build js
+
+package archive
+
+import (
+	"errors"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/wharf/eos"
+	"github.com/itchio/wharf/state"
+)
+
+// ErrSevenZipUnavailable is returned when trying to extract a 7-zip
+// archive from a build that doesn't include the native 7-zip extractor
+var ErrSevenZipUnavailable = errors.New("7-zip extraction is not available in this build")
+
+func newSzExtractor(file eos.File, consumer *state.Consumer) (savior.Extractor, error) {
+	return nil, ErrSevenZipUnavailable
+}
+
+func szFormat(ex savior.Extractor) (string, bool) {
+	return "", false
+}
+
+func szAvailable() bool {
+	return false
+}
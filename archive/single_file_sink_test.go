@@ -0,0 +1,63 @@
+package archive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSingleFileSink(t *testing.T) {
+	contents := strings.Repeat("to stdout and beyond\n", 1000)
+
+	extract := func(zipBytes []byte) (string, error) {
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetConsumer(&state.Consumer{})
+
+		out := new(bytes.Buffer)
+		_, err = ex.Resume(nil, &savior.SingleFileSink{
+			CanonicalPath: "only.txt",
+			Writer:        out,
+		})
+		return out.String(), err
+	}
+
+	out, err := extract(makeRawZip(t, []zipItem{
+		{name: "only.txt", data: contents},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, contents, out)
+
+	// anything besides that one file is refused
+	out, err = extract(makeRawZip(t, []zipItem{
+		{name: "only.txt", data: contents},
+		{name: "other.txt", data: "sneaky"},
+	}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected only.txt, was asked for other.txt")
+	assert.Equal(t, contents, out)
+
+	_, err = extract(makeRawZip(t, []zipItem{
+		{name: "dir/", data: ""},
+	}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "refusing to create directory")
+
+	// it can't seek back either
+	sink := &savior.SingleFileSink{CanonicalPath: "only.txt", Writer: new(bytes.Buffer)}
+	entry := &savior.Entry{CanonicalPath: "only.txt", Kind: savior.EntryKindFile}
+	w, err := sink.GetWriter(entry)
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	entry.WriteOffset = 0
+	_, err = sink.GetWriter(entry)
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// specialRecordingSink pretends to create special files
+type specialRecordingSink struct {
+	*savior.FolderSink
+	created []string
+}
+
+var _ savior.SpecialFileSink = (*specialRecordingSink)(nil)
+
+func (srs *specialRecordingSink) CreateSpecial(entry *savior.Entry) error {
+	srs.created = append(srs.created, entry.CanonicalPath)
+	return nil
+}
+
+func TestZipSpecialFilePolicy(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	fh := &zip.FileHeader{Name: "fifo"}
+	fh.SetMode(os.ModeNamedPipe | 0644)
+	_, err := zw.CreateHeader(fh)
+	assert.NoError(t, err)
+	w, err := zw.Create("regular.txt")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("regular"))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	dir, err := ioutil.TempDir("", "zipextractor-special")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	extract := func(policy savior.SpecialFilePolicy, sink savior.Sink) (map[string]savior.EntryOutcome, []string, error) {
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		var warnings []string
+		ex.SetConsumer(&state.Consumer{
+			OnMessage: func(lvl string, msg string) {
+				if lvl == "warning" {
+					warnings = append(warnings, msg)
+				}
+			},
+		})
+		ex.SetSpecialFilePolicy(policy)
+
+		res, err := ex.Resume(nil, sink)
+		if err != nil {
+			return nil, warnings, err
+		}
+		outcomes := make(map[string]savior.EntryOutcome)
+		for _, entry := range res.Entries {
+			outcomes[entry.CanonicalPath] = entry.Outcome
+		}
+		return outcomes, warnings, nil
+	}
+
+	folderSink := func(name string) *savior.FolderSink {
+		return &savior.FolderSink{Directory: filepath.Join(dir, name), Consumer: &state.Consumer{}}
+	}
+
+	// skipped by default, with a warning
+	outcomes, warnings, err := extract(savior.SpecialFilePolicySkip, folderSink("skip"))
+	assert.NoError(t, err)
+	assert.Equal(t, savior.EntryOutcomeSkipped, outcomes["fifo"])
+	assert.Equal(t, savior.EntryOutcomeWritten, outcomes["regular.txt"])
+	assert.Len(t, warnings, 1)
+	_, err = os.Lstat(filepath.Join(dir, "skip", "fifo"))
+	assert.True(t, os.IsNotExist(err))
+
+	// or fatal
+	_, _, err = extract(savior.SpecialFilePolicyError, folderSink("error"))
+	assert.Error(t, err)
+	se, ok := savior.UnwrapError(err).(*savior.ErrSpecialFile)
+	if assert.True(t, ok, "should fail with an ErrSpecialFile") {
+		assert.Equal(t, "fifo", se.Entry.CanonicalPath)
+	}
+
+	// or delegated to sinks that can create them
+	sink := &specialRecordingSink{FolderSink: folderSink("create")}
+	outcomes, warnings, err = extract(savior.SpecialFilePolicyCreate, sink)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"fifo"}, sink.created)
+	assert.Equal(t, savior.EntryOutcomeWritten, outcomes["fifo"])
+	assert.Empty(t, warnings)
+
+	// ..and skipped for those who can't
+	outcomes, warnings, err = extract(savior.SpecialFilePolicyCreate, folderSink("cant-create"))
+	assert.NoError(t, err)
+	assert.Equal(t, savior.EntryOutcomeSkipped, outcomes["fifo"])
+	assert.Len(t, warnings, 1)
+
+	assert.True(t, savior.IsSpecialMode(os.ModeNamedPipe|0644))
+	assert.False(t, savior.IsSpecialMode(0644))
+	assert.False(t, savior.IsSpecialMode(os.ModeDir|0755))
+}
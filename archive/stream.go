@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/bzip2source"
+	"github.com/itchio/savior/gzipsource"
+	"github.com/itchio/savior/readersource"
+	"github.com/itchio/savior/tarextractor"
+	"github.com/itchio/wharf/state"
+)
+
+type ExtractStreamParams struct {
+	// Reader is read once, from start to finish
+	Reader io.Reader
+	// Size is the length of Reader's contents, used for progress,
+	// or -1 if it's not known
+	Size int64
+	// Name is used to tell which kind of archive it is,
+	// like a file name would be
+	Name string
+
+	Sink     savior.Sink
+	Consumer *state.Consumer
+}
+
+// ExtractStream extracts an archive as it's being read (downloaded, for
+// example), without storing it first. Only formats that don't need random
+// access are supported: .tar, .tar.gz and .tar.bz2. Since the stream can't
+// be rewound, the extraction can't be resumed. Progress covers both
+// reading and extracting, if the size is known.
+func ExtractStream(params *ExtractStreamParams) (*savior.ExtractorResult, error) {
+	consumer := params.Consumer
+	if consumer == nil {
+		consumer = savior.NopConsumer()
+	}
+
+	source := readersource.New(params.Reader, params.Size)
+
+	var ex savior.Extractor
+	strategy := strategyForName(params.Name, consumer)
+	switch strategy {
+	case ArchiveStrategyTar:
+		ex = tarextractor.New(source)
+	case ArchiveStrategyTarGz:
+		ex = tarextractor.New(gzipsource.New(source))
+	case ArchiveStrategyTarBz2:
+		ex = tarextractor.New(bzip2source.New(source))
+	default:
+		return nil, fmt.Errorf("archive: can't extract %s (%s) from a stream, it needs random access", params.Name, strategy)
+	}
+	ex.SetConsumer(consumer)
+
+	res, err := ex.Resume(nil, params.Sink)
+	if err != nil {
+		return nil, errors.Wrap(err, 0)
+	}
+	return res, nil
+}
+
+// ExtractHTTPResponse extracts the archive in an HTTP response's body while
+// it's downloaded, see ExtractStream. Its kind is guessed from the request's
+// URL, and progress is reported if the response has a Content-Length.
+func ExtractHTTPResponse(res *http.Response, sink savior.Sink, consumer *state.Consumer) (*savior.ExtractorResult, error) {
+	var name string
+	if res.Request != nil && res.Request.URL != nil {
+		name = path.Base(res.Request.URL.Path)
+	}
+
+	return ExtractStream(&ExtractStreamParams{
+		Reader:   res.Body,
+		Size:     res.ContentLength,
+		Name:     name,
+		Sink:     sink,
+		Consumer: consumer,
+	})
+}
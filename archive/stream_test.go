@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/checker"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractHTTPResponse(t *testing.T) {
+	sink := checker.MakeTestSinkAdvanced(10)
+	tarBytes := checker.MakeTar(t, sink)
+	gzBytes, err := checker.GzipCompress(tarBytes)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "game.tar.gz", time.Time{}, bytes.NewReader(gzBytes))
+	}))
+	defer server.Close()
+
+	var lastProgress float64
+	consumer := &state.Consumer{
+		OnProgress: func(progress float64) {
+			lastProgress = progress
+		},
+	}
+
+	res, err := http.Get(server.URL + "/downloads/game.tar.gz")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	sink.Reset()
+	ares, err := ExtractHTTPResponse(res, sink, consumer)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Validate())
+
+	// the tar extractor only lists files in its result
+	numFiles := 0
+	for _, item := range sink.Items {
+		if item.Entry.Kind == savior.EntryKindFile {
+			numFiles++
+		}
+	}
+	assert.Equal(t, numFiles, len(ares.Entries))
+	assert.InDelta(t, 1.0, lastProgress, 0.05, "progress should follow the download")
+
+	// zip needs random access
+	res, err = http.Get(server.URL + "/downloads/game.zip")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	_, err = ExtractHTTPResponse(res, sink, consumer)
+	assert.Error(t, err)
+}
+
+func TestExtractStreamFromZipEntry(t *testing.T) {
+	sink := checker.MakeTestSinkAdvanced(10)
+	tarBytes := checker.MakeTar(t, sink)
+	gzBytes, err := checker.GzipCompress(tarBytes)
+	assert.NoError(t, err)
+
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "bundle/", data: ""},
+		{name: "bundle/game.tar.gz", data: string(gzBytes)},
+	})
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+
+	rc, entry, err := ex.EntryReader("bundle/game.tar.gz")
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(gzBytes), entry.UncompressedSize)
+
+	sink.Reset()
+	_, err = ExtractStream(&ExtractStreamParams{
+		Reader: rc,
+		Size:   entry.UncompressedSize,
+		Name:   entry.CanonicalPath,
+		Sink:   sink,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, rc.Close())
+	assert.NoError(t, sink.Validate())
+
+	_, _, err = ex.EntryReader("bundle")
+	assert.Error(t, err)
+	_, _, err = ex.EntryReader("bundle/missing.tar.gz")
+	assert.Error(t, err)
+}
@@ -1,10 +1,7 @@
 package szextractor
 
 import (
-	"crypto/sha1"
-	"crypto/sha256"
 	"fmt"
-	"hash"
 	"io"
 	"os"
 	"path/filepath"
@@ -86,70 +83,9 @@ func ensureDeps(consumer *state.Consumer) error {
 	}
 	defer lf.Unlock()
 
-	var toFetch []types.DepEntry
-
-	for _, entry := range depSpec.Entries {
-		func() {
-			entryPath := filepath.Join(execDir, entry.Name)
-
-			f, err := os.Open(entryPath)
-			if err != nil {
-				consumer.Debugf("")
-				consumer.Debugf("[%s] could not open, will fetch", entry.Name)
-				if !os.IsNotExist(err) {
-					consumer.Debugf("  %s", err.Error())
-				}
-				toFetch = append(toFetch, entry)
-				return
-			}
-
-			hashes := make(map[types.HashAlgo]hash.Hash)
-			for _, dh := range entry.Hashes {
-				switch dh.Algo {
-				case types.HashAlgoSHA1:
-					hashes[dh.Algo] = sha1.New()
-				case types.HashAlgoSHA256:
-					hashes[dh.Algo] = sha256.New()
-				}
-			}
-
-			if len(hashes) == 0 {
-				consumer.Debugf("No hashes to check, calling it a day.")
-				return
-			}
-
-			// oh go, I'm so disappoint in you right now
-			var writers []io.Writer
-			for _, h := range hashes {
-				writers = append(writers, h)
-			}
-			mw := io.MultiWriter(writers...)
-
-			_, err = io.Copy(mw, f)
-			if err != nil {
-				consumer.Debugf("Error during hashing of %s, will fetch: %s", entry.Name, err.Error())
-				toFetch = append(toFetch, entry)
-				return
-			}
-
-			for _, dh := range entry.Hashes {
-				h := hashes[dh.Algo]
-				if h != nil {
-					expected := dh.Value
-					// yes, yes, bytes.Equal is a thing. but also
-					// []byte{} literals are not the friendliest. don't @ me.
-					actual := fmt.Sprintf("%x", h.Sum(nil))
-					if actual != expected {
-						consumer.Debugf("")
-						consumer.Debugf("[%s] %s hash mismatch, will fetch", entry.Name, dh.Algo)
-						consumer.Debugf("  wanted %s", expected)
-						consumer.Debugf("     got %s", actual)
-						toFetch = append(toFetch, entry)
-						return
-					}
-				}
-			}
-		}()
+	toFetch, err := VerifyDeps(execDir, depSpec, verifyMode, consumer)
+	if err != nil {
+		return errors.Wrap(err, 0)
 	}
 
 	if len(toFetch) > 0 {
@@ -196,13 +132,7 @@ func ensureDeps(consumer *state.Consumer) error {
 								}
 								defer zer.Close()
 
-								of, err := os.Create(entryPath)
-								if err != nil {
-									return errors.Wrap(err, 0)
-								}
-								defer of.Close()
-
-								writtenBytes, err := io.Copy(of, zer)
+								writtenBytes, err := InstallDep(zer, entryPath, entry)
 								if err != nil {
 									return errors.Wrap(err, 0)
 								}
@@ -238,3 +168,36 @@ func ensureDeps(consumer *state.Consumer) error {
 	ensuredDeps = true
 	return nil
 }
+
+// InstallDep writes the contents of a dependency, read from r, to
+// entryPath, hashing them on the fly with each of the algorithms entry
+// has hashes for. If any of them doesn't match in the end, the file is
+// removed, and an *ErrDepHashMismatch is returned, so a bad dependency
+// never stays on disk. It returns how many bytes were written.
+func InstallDep(r io.Reader, entryPath string, entry types.DepEntry) (int64, error) {
+	hashes := depHashes(entry)
+	writers := []io.Writer{}
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+
+	of, err := os.Create(entryPath)
+	if err != nil {
+		return 0, errors.Wrap(err, 0)
+	}
+
+	writtenBytes, err := io.Copy(io.MultiWriter(append(writers, of)...), r)
+	if err == nil {
+		err = checkDepHashes(entry, hashes)
+	}
+	closeErr := of.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(entryPath)
+		return 0, errors.Wrap(err, 0)
+	}
+	return writtenBytes, nil
+}
@@ -0,0 +1,99 @@
+package szextractor
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/butler/archive/szextractor/types"
+	"github.com/itchio/wharf/eos"
+	"lukechampine.com/blake3"
+)
+
+// newHash returns a hash for algo, or nil if it's not supported
+func newHash(algo types.HashAlgo) hash.Hash {
+	switch algo {
+	case types.HashAlgoSHA1:
+		return sha1.New()
+	case types.HashAlgoSHA256:
+		return sha256.New()
+	case types.HashAlgoSHA512:
+		return sha512.New()
+	case types.HashAlgoBLAKE3:
+		return blake3.New(32, nil)
+	}
+	return nil
+}
+
+// BuildDepSpec hashes every file of the zip archive in source with each
+// of algos, and returns a DepSpec listing them, in archive order. Only
+// files are covered: directory entries are skipped, so empty directories
+// aren't part of the DepSpec. Its Sources are left empty, since only the
+// caller knows where the archive can be downloaded from.
+func BuildDepSpec(source eos.File, algos []types.HashAlgo) (types.DepSpec, error) {
+	ds := types.DepSpec{}
+
+	for _, algo := range algos {
+		if newHash(algo) == nil {
+			return ds, fmt.Errorf("szextractor: unsupported hash algorithm %q", algo)
+		}
+	}
+
+	stats, err := source.Stat()
+	if err != nil {
+		return ds, errors.Wrap(err, 0)
+	}
+
+	zr, err := zip.NewReader(source, stats.Size())
+	if err != nil {
+		return ds, errors.Wrap(err, 0)
+	}
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+
+		de, err := hashDepEntry(zf, algos)
+		if err != nil {
+			return ds, errors.Wrap(err, 0)
+		}
+		ds.Entries = append(ds.Entries, de)
+	}
+
+	return ds, nil
+}
+
+func hashDepEntry(zf *zip.File, algos []types.HashAlgo) (types.DepEntry, error) {
+	de := types.DepEntry{
+		Name: zf.Name,
+	}
+
+	r, err := zf.Open()
+	if err != nil {
+		return de, errors.Wrap(err, 0)
+	}
+	defer r.Close()
+
+	var hashes []hash.Hash
+	for _, algo := range algos {
+		hashes = append(hashes, newHash(algo))
+	}
+
+	de.Size, err = types.HashParallel(r, hashes)
+	if err != nil {
+		return de, errors.Wrap(err, 0)
+	}
+
+	for i, algo := range algos {
+		de.Hashes = append(de.Hashes, types.DepHash{
+			Algo:  algo,
+			Value: fmt.Sprintf("%x", hashes[i].Sum(nil)),
+		})
+	}
+	return de, nil
+}
@@ -3,11 +3,7 @@
 package main
 
 import (
-	"crypto/sha1"
-	"crypto/sha256"
 	"fmt"
-	"hash"
-	"io"
 	"log"
 	"os"
 	"sync"
@@ -16,7 +12,7 @@ import (
 
 	humanize "github.com/dustin/go-humanize"
 
-	"github.com/itchio/arkive/zip"
+	"github.com/itchio/butler/archive/szextractor"
 	"github.com/itchio/butler/archive/szextractor/types"
 	"github.com/itchio/wharf/eos"
 )
@@ -46,60 +42,20 @@ func main() {
 
 		log.Printf("Hashing files for %s", osarch)
 
-		ds := types.DepSpec{}
-
 		zipURL := fmt.Sprintf("%s/%s/%s/libc7zip.zip", baseURL, osarch, version)
 
 		f, err := eos.Open(zipURL)
 		must(err)
 		defer f.Close()
 
-		stats, err := f.Stat()
-		must(err)
-
-		zr, err := zip.NewReader(f, stats.Size())
+		ds, err := szextractor.BuildDepSpec(f, []types.HashAlgo{
+			types.HashAlgoSHA1,
+			types.HashAlgoSHA256,
+		})
 		must(err)
 
-		log.Printf("  %d files to process", len(zr.File))
-
-		for _, f := range zr.File {
-			func() {
-				log.Printf("  - %s (%s)...", f.Name, humanize.IBytes(uint64(f.UncompressedSize64)))
-
-				de := types.DepEntry{
-					Name: f.Name,
-				}
-
-				r, err := f.Open()
-				must(err)
-				defer r.Close()
-
-				hashes := map[types.HashAlgo]hash.Hash{
-					types.HashAlgoSHA1:   sha1.New(),
-					types.HashAlgoSHA256: sha256.New(),
-				}
-
-				var writers []io.Writer
-				for _, h := range hashes {
-					writers = append(writers, h)
-				}
-
-				mw := io.MultiWriter(writers...)
-
-				copiedBytes, err := io.Copy(mw, r)
-				must(err)
-
-				de.Size = copiedBytes
-
-				for algo, h := range hashes {
-					de.Hashes = append(de.Hashes, types.DepHash{
-						Algo:  algo,
-						Value: fmt.Sprintf("%x", h.Sum(nil)),
-					})
-				}
-
-				ds.Entries = append(ds.Entries, de)
-			}()
+		for _, de := range ds.Entries {
+			log.Printf("  - %s (%s)", de.Name, humanize.IBytes(uint64(de.Size)))
 		}
 
 		ds.Sources = append(ds.Sources, zipURL)
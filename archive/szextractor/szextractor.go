@@ -11,6 +11,7 @@ import (
 
 	humanize "github.com/dustin/go-humanize"
 	"github.com/go-errors/errors"
+	"github.com/itchio/butler/archive/szextractor/types"
 	"github.com/itchio/savior"
 	"github.com/itchio/sevenzip-go/sz"
 	"github.com/itchio/wharf/archiver"
@@ -20,6 +21,14 @@ import (
 
 var dontEnsureDeps = os.Getenv("BUTLER_NO_DEPS") == "1"
 var ensuredDeps = false
+var verifyMode = types.VerifyModeFull
+
+// SetVerifyMode changes how already-installed dependencies are checked
+// before the first extraction, see VerifyDeps. The default is
+// types.VerifyModeFull.
+func SetVerifyMode(mode types.VerifyMode) {
+	verifyMode = mode
+}
 
 type SzExtractor interface {
 	savior.Extractor
@@ -47,6 +56,17 @@ type szExtractor struct {
 
 var _ SzExtractor = (*szExtractor)(nil)
 
+// Available returns nil if the native 7-zip library can be loaded. It
+// doesn't install it: New does that before the first extraction.
+func Available() error {
+	lib, err := sz.NewLib()
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	lib.Free()
+	return nil
+}
+
 func New(file eos.File, consumer *state.Consumer) (SzExtractor, error) {
 	se := &szExtractor{
 		file:          file,
@@ -197,7 +217,7 @@ func (se *szExtractor) Resume(checkpoint *savior.ExtractorCheckpoint, sink savio
 				entry := szEntry(item)
 
 				if entry.Kind == savior.EntryKindFile {
-					err = sink.Preallocate(entry)
+					err = savior.Preallocate(sink, entry)
 					if err != nil {
 						return errors.Wrap(err, 0)
 					}
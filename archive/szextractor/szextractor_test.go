@@ -2,17 +2,26 @@ package szextractor_test
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/itchio/arkive/zip"
 	"github.com/itchio/butler/archive/szextractor"
+	"github.com/itchio/butler/archive/szextractor/types"
 	"github.com/itchio/savior"
 	"github.com/itchio/savior/checker"
 	"github.com/itchio/wharf/eos"
 	"github.com/itchio/wharf/state"
 	"github.com/stretchr/testify/assert"
+	"lukechampine.com/blake3"
 )
 
 func must(t *testing.T, err error) {
@@ -119,3 +128,121 @@ func (mfi *memoryFileInfo) IsDir() bool {
 func (mfi *memoryFileInfo) Sys() interface{} {
 	return nil
 }
+
+func TestBuildDepSpec(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	_, err := zw.Create("lib/")
+	must(t, err)
+	w, err := zw.Create("lib/libc7zip.so")
+	must(t, err)
+	_, err = w.Write([]byte("not really a library"))
+	must(t, err)
+	must(t, zw.Close())
+
+	file := &memoryFile{
+		br:   bytes.NewReader(buf.Bytes()),
+		name: "libc7zip.zip",
+	}
+
+	ds, err := szextractor.BuildDepSpec(file, []types.HashAlgo{types.HashAlgoSHA256, types.HashAlgoSHA1, types.HashAlgoBLAKE3})
+	must(t, err)
+
+	// directories aren't listed
+	if assert.Len(t, ds.Entries, 1) {
+		de := ds.Entries[0]
+		assert.Equal(t, "lib/libc7zip.so", de.Name)
+		assert.EqualValues(t, 20, de.Size)
+		assert.Equal(t, []types.DepHash{
+			{Algo: types.HashAlgoSHA256, Value: fmt.Sprintf("%x", sha256.Sum256([]byte("not really a library")))},
+			{Algo: types.HashAlgoSHA1, Value: fmt.Sprintf("%x", sha1.Sum([]byte("not really a library")))},
+			{Algo: types.HashAlgoBLAKE3, Value: fmt.Sprintf("%x", blake3.Sum256([]byte("not really a library")))},
+		}, de.Hashes)
+	}
+	assert.Empty(t, ds.Sources)
+
+	_, err = szextractor.BuildDepSpec(file, []types.HashAlgo{"md4"})
+	assert.Error(t, err)
+}
+
+func TestVerifyDeps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verifydeps-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+
+	contents := []byte("not really a library")
+	libPath := filepath.Join(dir, "libc7zip.so")
+	must(t, ioutil.WriteFile(libPath, contents, 0644))
+
+	sum := sha512.Sum512(contents)
+	depSpec := &types.DepSpec{
+		Entries: []types.DepEntry{
+			{
+				Name: "libc7zip.so",
+				Size: int64(len(contents)),
+				Hashes: []types.DepHash{
+					{Algo: types.HashAlgoSHA512, Value: fmt.Sprintf("%x", sum[:])},
+				},
+			},
+		},
+	}
+	consumer := &state.Consumer{}
+
+	toFetch, err := szextractor.VerifyDeps(dir, depSpec, types.VerifyModeFull, consumer)
+	must(t, err)
+	assert.Empty(t, toFetch)
+
+	// same size, same mtime: quick mode trusts it, full mode doesn't
+	stats, err := os.Stat(libPath)
+	must(t, err)
+	must(t, ioutil.WriteFile(libPath, []byte("NOT REALLY A LIBRARY"), 0644))
+	must(t, os.Chtimes(libPath, stats.ModTime(), stats.ModTime()))
+
+	toFetch, err = szextractor.VerifyDeps(dir, depSpec, types.VerifyModeQuickSizeMtime, consumer)
+	must(t, err)
+	assert.Empty(t, toFetch)
+
+	toFetch, err = szextractor.VerifyDeps(dir, depSpec, types.VerifyModeFull, consumer)
+	must(t, err)
+	assert.Len(t, toFetch, 1)
+
+	// once it's failed, quick mode hashes it again too
+	toFetch, err = szextractor.VerifyDeps(dir, depSpec, types.VerifyModeQuickSizeMtime, consumer)
+	must(t, err)
+	assert.Len(t, toFetch, 1)
+}
+
+func TestInstallDep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "installdep-test")
+	must(t, err)
+	defer os.RemoveAll(dir)
+
+	contents := []byte("not really a library")
+	sha1Sum := sha1.Sum(contents)
+	sha256Sum := sha256.Sum256(contents)
+	entry := types.DepEntry{
+		Name: "libc7zip.so",
+		Size: int64(len(contents)),
+		Hashes: []types.DepHash{
+			{Algo: types.HashAlgoSHA1, Value: fmt.Sprintf("%x", sha1Sum[:])},
+			{Algo: types.HashAlgoSHA256, Value: fmt.Sprintf("%x", sha256Sum[:])},
+		},
+	}
+	libPath := filepath.Join(dir, entry.Name)
+
+	written, err := szextractor.InstallDep(bytes.NewReader(contents), libPath, entry)
+	must(t, err)
+	assert.EqualValues(t, len(contents), written)
+
+	installed, err := ioutil.ReadFile(libPath)
+	must(t, err)
+	assert.Equal(t, contents, installed)
+
+	// a bad download doesn't stay on disk
+	_, err = szextractor.InstallDep(bytes.NewReader([]byte("NOT REALLY A LIBRARY")), libPath, entry)
+	if he, ok := savior.UnwrapError(err).(*szextractor.ErrDepHashMismatch); assert.True(t, ok, "should fail with a hash mismatch") {
+		assert.Equal(t, entry.Name, he.Name)
+	}
+	_, err = os.Stat(libPath)
+	assert.True(t, os.IsNotExist(err))
+}
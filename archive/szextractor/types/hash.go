@@ -0,0 +1,69 @@
+package types
+
+import (
+	"hash"
+	"io"
+	"sync"
+)
+
+// hashChunkSize is how much is read at once by HashParallel
+const hashChunkSize = 1024 * 1024
+
+// HashParallel feeds everything read from r to each of hashes, each in
+// its own goroutine, so they're computed in parallel rather than one
+// after the other like with io.MultiWriter. It still streams: only two
+// chunks of r are in memory at any time, one being read while the other
+// is hashed. It returns how many bytes were read.
+func HashParallel(r io.Reader, hashes []hash.Hash) (int64, error) {
+	if len(hashes) == 1 {
+		return io.Copy(hashes[0], r)
+	}
+
+	var wg sync.WaitGroup
+	chunks := make([]chan []byte, len(hashes))
+	for i, h := range hashes {
+		chunks[i] = make(chan []byte)
+		go func(h hash.Hash, chunks chan []byte) {
+			for chunk := range chunks {
+				// hash.Hash's Write never returns an error
+				h.Write(chunk)
+				wg.Done()
+			}
+		}(h, chunks[i])
+	}
+	defer func() {
+		wg.Wait()
+		for _, c := range chunks {
+			close(c)
+		}
+	}()
+
+	bufs := [2][]byte{
+		make([]byte, hashChunkSize),
+		make([]byte, hashChunkSize),
+	}
+	current := 0
+
+	var total int64
+	for {
+		n, err := io.ReadFull(r, bufs[current])
+		if n > 0 {
+			// wait for the previous chunk to be hashed by everyone
+			wg.Wait()
+
+			wg.Add(len(hashes))
+			for _, c := range chunks {
+				c <- bufs[current][:n]
+			}
+			total += int64(n)
+			current = 1 - current
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package types_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/itchio/butler/archive/szextractor/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeHashes() []hash.Hash {
+	return []hash.Hash{sha1.New(), sha256.New()}
+}
+
+func randomData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(0x5eed)).Read(data)
+	return data
+}
+
+func TestHashParallel(t *testing.T) {
+	for _, size := range []int{0, 1, 1024*1024 - 1, 1024 * 1024, 3*1024*1024 + 17} {
+		data := randomData(size)
+
+		reference := makeHashes()
+		var writers []io.Writer
+		for _, h := range reference {
+			writers = append(writers, h)
+		}
+		_, err := io.Copy(io.MultiWriter(writers...), bytes.NewReader(data))
+		assert.NoError(t, err)
+
+		hashes := makeHashes()
+		n, err := types.HashParallel(bytes.NewReader(data), hashes)
+		assert.NoError(t, err)
+		assert.EqualValues(t, size, n)
+
+		for i := range hashes {
+			assert.Equal(t, reference[i].Sum(nil), hashes[i].Sum(nil), "size %d, hash %d", size, i)
+		}
+	}
+}
+
+const benchmarkSize = 50 * 1024 * 1024
+
+func BenchmarkHashMultiWriter50MB(b *testing.B) {
+	data := randomData(benchmarkSize)
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var writers []io.Writer
+		for _, h := range makeHashes() {
+			writers = append(writers, h)
+		}
+		_, err := io.Copy(io.MultiWriter(writers...), bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHashParallel50MB(b *testing.B) {
+	data := randomData(benchmarkSize)
+	b.SetBytes(benchmarkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := types.HashParallel(bytes.NewReader(data), makeHashes())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
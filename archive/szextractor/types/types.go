@@ -18,6 +18,10 @@ type HashAlgo string
 const (
 	HashAlgoSHA1   = "sha1"
 	HashAlgoSHA256 = "sha256"
+	HashAlgoSHA512 = "sha512"
+	// HashAlgoBLAKE3 is much faster than the SHA family on large files,
+	// with a 256-bit digest
+	HashAlgoBLAKE3 = "blake3"
 )
 
 type DepHash struct {
@@ -25,3 +29,15 @@ type DepHash struct {
 	// byte array formatted with `%x` (lower-case hex)
 	Value string
 }
+
+// VerifyMode decides how installed dependencies are checked
+type VerifyMode int
+
+const (
+	// VerifyModeFull hashes every dependency every time
+	VerifyModeFull VerifyMode = 0
+	// VerifyModeQuickSizeMtime only hashes dependencies whose size or
+	// modification time changed since they were last hashed successfully.
+	// It's meant for trusted local caches, where startup time matters more.
+	VerifyModeQuickSizeMtime VerifyMode = 1
+)
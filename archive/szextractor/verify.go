@@ -0,0 +1,203 @@
+package szextractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/butler/archive/szextractor/types"
+	"github.com/itchio/wharf/state"
+)
+
+// verifiedCacheName is the file, next to the dependencies, that remembers
+// the size and modification time they had when last hashed successfully
+const verifiedCacheName = ".butler-deps.verified"
+
+type verifiedStat struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// VerifyDeps checks the dependencies of depSpec installed in dir, and
+// returns the ones that are missing or don't match, which need to be
+// fetched again.
+//
+// In VerifyModeQuickSizeMtime, dependencies that have the same size and
+// modification time as when they were last hashed successfully (in any
+// mode) aren't hashed again.
+func VerifyDeps(dir string, depSpec *types.DepSpec, mode types.VerifyMode, consumer *state.Consumer) ([]types.DepEntry, error) {
+	cachePath := filepath.Join(dir, verifiedCacheName)
+	cache := readVerifiedCache(cachePath)
+	cacheChanged := false
+
+	var toFetch []types.DepEntry
+	for _, entry := range depSpec.Entries {
+		entryPath := filepath.Join(dir, entry.Name)
+
+		stats, err := os.Stat(entryPath)
+		if err == nil && mode == types.VerifyModeQuickSizeMtime {
+			if vs, ok := cache[entry.Name]; ok && vs.Size == stats.Size() && vs.ModTime.Equal(stats.ModTime()) && (entry.Size == 0 || entry.Size == stats.Size()) {
+				consumer.Debugf("[%s] unchanged since last verified, not hashing", entry.Name)
+				continue
+			}
+		}
+
+		ok := verifyDep(entryPath, entry, consumer)
+		if !ok {
+			toFetch = append(toFetch, entry)
+			if _, had := cache[entry.Name]; had {
+				delete(cache, entry.Name)
+				cacheChanged = true
+			}
+			continue
+		}
+
+		if stats != nil {
+			vs := verifiedStat{Size: stats.Size(), ModTime: stats.ModTime()}
+			if cache[entry.Name] != vs {
+				cache[entry.Name] = vs
+				cacheChanged = true
+			}
+		}
+	}
+
+	if cacheChanged {
+		err := writeVerifiedCache(cachePath, cache)
+		if err != nil {
+			// it's only an optimization
+			consumer.Debugf("Could not write verified deps cache: %s", err.Error())
+		}
+	}
+
+	return toFetch, nil
+}
+
+// verifyDep hashes a single dependency, returning false
+// if it's missing or doesn't match its DepEntry
+func verifyDep(entryPath string, entry types.DepEntry, consumer *state.Consumer) bool {
+	f, err := os.Open(entryPath)
+	if err != nil {
+		consumer.Debugf("")
+		consumer.Debugf("[%s] could not open, will fetch", entry.Name)
+		if !os.IsNotExist(err) {
+			consumer.Debugf("  %s", err.Error())
+		}
+		return false
+	}
+	defer f.Close()
+
+	hashes := depHashes(entry)
+	if len(hashes) == 0 {
+		consumer.Debugf("No hashes to check, calling it a day.")
+		return true
+	}
+
+	var hashList []hash.Hash
+	for _, h := range hashes {
+		hashList = append(hashList, h)
+	}
+
+	_, err = types.HashParallel(f, hashList)
+	if err != nil {
+		consumer.Debugf("Error during hashing of %s, will fetch: %s", entry.Name, err.Error())
+		return false
+	}
+
+	err = checkDepHashes(entry, hashes)
+	if err != nil {
+		if he, ok := err.(*ErrDepHashMismatch); ok {
+			consumer.Debugf("")
+			consumer.Debugf("[%s] %s hash mismatch, will fetch", entry.Name, he.Algo)
+			consumer.Debugf("  wanted %s", he.Expected)
+			consumer.Debugf("     got %s", he.Actual)
+		}
+		return false
+	}
+
+	return true
+}
+
+// ErrDepHashMismatch is returned when a dependency doesn't
+// have the hash its DepEntry says it should
+type ErrDepHashMismatch struct {
+	Name     string
+	Algo     types.HashAlgo
+	Expected string
+	Actual   string
+}
+
+var _ error = (*ErrDepHashMismatch)(nil)
+
+func (e *ErrDepHashMismatch) Error() string {
+	return fmt.Sprintf("%s: %s hash mismatch, expected %s, got %s", e.Name, e.Algo, e.Expected, e.Actual)
+}
+
+// depHashes returns a hasher for each of entry's hashes
+// whose algorithm is supported, by algorithm
+func depHashes(entry types.DepEntry) map[types.HashAlgo]hash.Hash {
+	hashes := make(map[types.HashAlgo]hash.Hash)
+	for _, dh := range entry.Hashes {
+		if h := newHash(dh.Algo); h != nil {
+			hashes[dh.Algo] = h
+		}
+	}
+	return hashes
+}
+
+// checkDepHashes compares hashes, once they've been fed the whole
+// dependency, to entry's, and returns an *ErrDepHashMismatch for
+// the first one that doesn't match
+func checkDepHashes(entry types.DepEntry, hashes map[types.HashAlgo]hash.Hash) error {
+	for _, dh := range entry.Hashes {
+		h := hashes[dh.Algo]
+		if h != nil {
+			expected := dh.Value
+			// yes, yes, bytes.Equal is a thing. but also
+			// []byte{} literals are not the friendliest. don't @ me.
+			actual := fmt.Sprintf("%x", h.Sum(nil))
+			if actual != expected {
+				return &ErrDepHashMismatch{
+					Name:     entry.Name,
+					Algo:     dh.Algo,
+					Expected: expected,
+					Actual:   actual,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func readVerifiedCache(cachePath string) map[string]verifiedStat {
+	cache := make(map[string]verifiedStat)
+
+	data, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		return cache
+	}
+
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		// start over
+		return make(map[string]verifiedStat)
+	}
+	return cache
+}
+
+func writeVerifiedCache(cachePath string, cache map[string]verifiedStat) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+
+	err = ioutil.WriteFile(cachePath, data, 0644)
+	if err != nil {
+		return errors.Wrap(err, 0)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeThrottleClock only moves when told to, and runs timers
+// synchronously when they come due
+type fakeThrottleClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	when    time.Time
+	f       func()
+	stopped bool
+}
+
+var _ state.ThrottleClock = (*fakeThrottleClock)(nil)
+
+func (fc *fakeThrottleClock) Now() time.Time {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	return fc.now
+}
+
+func (fc *fakeThrottleClock) AfterFunc(d time.Duration, f func()) func() bool {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	timer := &fakeTimer{when: fc.now.Add(d), f: f}
+	fc.timers = append(fc.timers, timer)
+	return func() bool {
+		fc.mutex.Lock()
+		defer fc.mutex.Unlock()
+		wasPending := !timer.stopped
+		timer.stopped = true
+		return wasPending
+	}
+}
+
+func (fc *fakeThrottleClock) Advance(d time.Duration) {
+	fc.mutex.Lock()
+	fc.now = fc.now.Add(d)
+	var due []*fakeTimer
+	var remaining []*fakeTimer
+	for _, timer := range fc.timers {
+		if timer.stopped {
+			continue
+		}
+		if !timer.when.After(fc.now) {
+			timer.stopped = true
+			due = append(due, timer)
+		} else {
+			remaining = append(remaining, timer)
+		}
+	}
+	fc.timers = remaining
+	fc.mutex.Unlock()
+
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+func TestThrottleProgress(t *testing.T) {
+	clock := &fakeThrottleClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	var forwarded []float64
+	tc := state.Throttle(&state.Consumer{
+		OnProgress: func(alpha float64) {
+			forwarded = append(forwarded, alpha)
+		},
+	}, state.ThrottleSettings{
+		ProgressInterval: 100 * time.Millisecond,
+		Clock:            clock,
+	})
+
+	// the first call goes through, the next ones are held back
+	tc.Progress(0.1)
+	clock.Advance(10 * time.Millisecond)
+	tc.Progress(0.2)
+	clock.Advance(10 * time.Millisecond)
+	tc.Progress(0.3)
+	assert.EqualValues(t, []float64{0.1}, forwarded)
+
+	// the extraction stalls: the last one held back still shows up
+	// once the interval has passed
+	clock.Advance(79 * time.Millisecond)
+	assert.EqualValues(t, []float64{0.1}, forwarded)
+	clock.Advance(time.Millisecond)
+	assert.EqualValues(t, []float64{0.1, 0.3}, forwarded)
+
+	// and only once
+	clock.Advance(time.Second)
+	assert.EqualValues(t, []float64{0.1, 0.3}, forwarded)
+
+	// calls far enough apart go through right away
+	tc.Progress(0.4)
+	assert.EqualValues(t, []float64{0.1, 0.3, 0.4}, forwarded)
+
+	// completion always goes through, and replaces what was held back
+	clock.Advance(10 * time.Millisecond)
+	tc.Progress(0.5)
+	tc.Progress(1.0)
+	clock.Advance(time.Second)
+	assert.EqualValues(t, []float64{0.1, 0.3, 0.4, 1.0}, forwarded)
+}
+
+func TestThrottleDebug(t *testing.T) {
+	clock := &fakeThrottleClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	var messages []string
+	tc := state.Throttle(&state.Consumer{
+		OnMessage: func(level string, msg string) {
+			messages = append(messages, level+": "+msg)
+		},
+	}, state.ThrottleSettings{
+		DebugInterval: time.Second,
+		Clock:         clock,
+	})
+
+	tc.Debugf("one")
+	tc.Debugf("two")
+	tc.Infof("info isn't throttled")
+	clock.Advance(time.Second)
+	tc.Debugf("three")
+
+	assert.EqualValues(t, []string{
+		"debug: one",
+		"info: info isn't throttled",
+		"debug: three",
+	}, messages)
+}
@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction-sink")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	install := filepath.Join(dir, "install")
+	assert.NoError(t, os.MkdirAll(install, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(install, "old.txt"), []byte("previous version"), 0644))
+
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "game/", data: ""},
+		{name: "game/data.txt", data: "new version"},
+	})
+
+	extract := func(check func(staged savior.InspectableSink) error) (*savior.TransactionSink, error) {
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+
+		sink := &savior.TransactionSink{
+			Directory: install,
+			Consumer:  &state.Consumer{},
+			Check:     check,
+		}
+		_, err = ex.Resume(nil, sink)
+		return sink, err
+	}
+
+	assertOldVersion := func() {
+		data, err := ioutil.ReadFile(filepath.Join(install, "old.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "previous version", string(data))
+
+		_, err = os.Stat(filepath.Join(install, "game"))
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = os.Stat(install + ".staging")
+		assert.True(t, os.IsNotExist(err), "staging folder should be gone")
+	}
+
+	// nothing changes until it's committed, or if it's rolled back
+	sink, err := extract(nil)
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(install, "game", "data.txt"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, sink.Rollback())
+	assertOldVersion()
+
+	// a failed check rolls back too
+	sink, err = extract(func(staged savior.InspectableSink) error {
+		files, err := staged.ListFiles()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("unexpected files: %v", files)
+	})
+	assert.NoError(t, err)
+	assert.Error(t, sink.Commit())
+	assertOldVersion()
+
+	// committing replaces the previous version
+	sink, err = extract(func(staged savior.InspectableSink) error {
+		_, err := staged.FileInfo("game/data.txt")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Commit())
+
+	data, err := ioutil.ReadFile(filepath.Join(install, "game", "data.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new version", string(data))
+
+	_, err = os.Stat(filepath.Join(install, "old.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	for _, leftover := range []string{install + ".staging", install + ".previous"} {
+		_, err = os.Stat(leftover)
+		assert.True(t, os.IsNotExist(err), "%s should be gone", leftover)
+	}
+}
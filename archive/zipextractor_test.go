@@ -0,0 +1,2657 @@
+package archive
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-errors/errors"
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/checker"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/eos"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/japanese"
+)
+
+type zipItem struct {
+	name string
+	data string
+}
+
+func makeRawZip(t *testing.T, items []zipItem) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+
+	for _, item := range items {
+		fh := &zip.FileHeader{
+			Name:   item.name,
+			Method: zip.Deflate,
+		}
+		if item.name[len(item.name)-1] == '/' || item.name[len(item.name)-1] == '\\' {
+			fh.SetMode(os.ModeDir | 0755)
+		} else {
+			fh.SetMode(0644)
+		}
+
+		w, err := zw.CreateHeader(fh)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(item.data))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func extractRawZip(t *testing.T, zipBytes []byte) (string, *savior.ExtractorResult) {
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+
+	sink := &savior.FolderSink{
+		// nested twice, so escapes don't end up outside of dir
+		Directory: filepath.Join(dir, "x", "out"),
+		Consumer:  &state.Consumer{},
+	}
+
+	res, err := ex.Resume(nil, sink)
+	assert.NoError(t, err)
+	return dir, res
+}
+
+func countEntries(res *savior.ExtractorResult, kind savior.EntryKind) int {
+	count := 0
+	for _, entry := range res.Entries {
+		if entry.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func TestCleanPath(t *testing.T) {
+	cases := map[string]string{
+		"foo/bar.txt":        "foo/bar.txt",
+		`foo\bar.txt`:        "foo/bar.txt",
+		`dir\`:               "dir",
+		"dir/":               "dir",
+		"./a/b.txt":          "a/b.txt",
+		"a//c.txt":           "a/c.txt",
+		"a/./b/../c.txt":     "a/c.txt",
+		"/abs/file.txt":      "abs/file.txt",
+		"../evil.txt":        "../evil.txt",
+		`..\..\evil.txt`:     "../../evil.txt",
+		"a/../../escape.txt": "../escape.txt",
+	}
+
+	for input, expected := range cases {
+		assert.Equal(t, expected, savior.CleanPath(input), "cleaning %q", input)
+	}
+
+	assert.True(t, savior.IsSafePath("a/b.txt"))
+	assert.False(t, savior.IsSafePath("."))
+	assert.False(t, savior.IsSafePath(".."))
+	assert.False(t, savior.IsSafePath("../evil.txt"))
+	assert.False(t, savior.IsSafePath("C:/Windows/evil.dll"))
+}
+
+func TestZipWindowsSeparators(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: `assets\`},
+		{name: `assets\textures\`},
+		{name: `assets\textures\grass.png`, data: "grass"},
+		{name: `assets/sounds\jump.wav`, data: "jump"},
+	})
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	manifest, err := ex.Manifest()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, manifest.NumEntries)
+	assert.Equal(t, 2, manifest.NumDirs)
+	assert.Equal(t, 2, manifest.NumFiles)
+	assert.EqualValues(t, len("grass")+len("jump"), manifest.UncompressedSize)
+
+	dir, res := extractRawZip(t, zipBytes)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "x", "out")
+
+	data, err := ioutil.ReadFile(filepath.Join(out, "assets", "textures", "grass.png"))
+	assert.NoError(t, err)
+	assert.Equal(t, "grass", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(out, "assets", "sounds", "jump.wav"))
+	assert.NoError(t, err)
+	assert.Equal(t, "jump", string(data))
+
+	paths := make(map[string]string)
+	for _, entry := range res.Entries {
+		paths[entry.CanonicalPath] = entry.OriginalPath
+	}
+	assert.Equal(t, `assets\`, paths["assets"])
+	assert.Equal(t, `assets\textures\grass.png`, paths["assets/textures/grass.png"])
+	assert.Equal(t, 2, countEntries(res, savior.EntryKindDir))
+}
+
+func TestZipPathologicalNames(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "./"},
+		{name: "./a/b.txt", data: "b"},
+		{name: "a//c.txt", data: "c"},
+		{name: "a/./d/../e.txt", data: "e"},
+		{name: "../evil.txt", data: "evil"},
+		{name: `..\..\evil2.txt`, data: "evil"},
+		{name: "a/../../evil3.txt", data: "evil"},
+	})
+
+	dir, res := extractRawZip(t, zipBytes)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "x", "out")
+
+	for name, contents := range map[string]string{
+		"a/b.txt": "b",
+		"a/c.txt": "c",
+		"a/e.txt": "e",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		assert.NoError(t, err)
+		assert.Equal(t, contents, string(data))
+	}
+
+	for _, name := range []string{"x/evil.txt", "evil2.txt", "x/evil3.txt"} {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		assert.True(t, os.IsNotExist(err), "%s should not have been extracted", name)
+	}
+
+	assert.Equal(t, 3, countEntries(res, savior.EntryKindFile))
+}
+
+func TestZipConcurrentExtractEntry(t *testing.T) {
+	sink := checker.MakeTestSinkAdvanced(20)
+	zipBytes := checker.MakeZip(t, sink)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	// fewer than workers, so some of them have to wait
+	ex.SetMaxOpenFiles(3)
+
+	dir, err := ioutil.TempDir("", "zipextractor-concurrent")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	const numWorkers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			fsink := &savior.FolderSink{
+				Directory: filepath.Join(dir, fmt.Sprintf("worker%d", i)),
+				Consumer:  &state.Consumer{},
+			}
+
+			for _, entry := range ex.List() {
+				if entry.Kind == savior.EntryKindSymlink {
+					// not all platforms support symlinks
+					continue
+				}
+				assert.NoError(t, ex.ExtractEntry(entry.CanonicalPath, fsink))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < numWorkers; i++ {
+		for _, item := range sink.Items {
+			if item.Entry.Kind != savior.EntryKindFile {
+				continue
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("worker%d", i), filepath.FromSlash(item.Entry.CanonicalPath)))
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(item.Data, data), "%s should have the right contents", item.Entry.CanonicalPath)
+		}
+	}
+}
+
+func TestZipConcurrentExtractEntrySharedSink(t *testing.T) {
+	sink := checker.MakeTestSinkAdvanced(20)
+	zipBytes := checker.MakeZip(t, sink)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "zipextractor-concurrent")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// all workers write to the same sink, each to their own entries
+	fsink := &savior.FolderSink{
+		Directory: dir,
+		Consumer:  &state.Consumer{},
+	}
+
+	var dirs []string
+	var files []string
+	for _, entry := range ex.List() {
+		switch entry.Kind {
+		case savior.EntryKindDir:
+			dirs = append(dirs, entry.CanonicalPath)
+		case savior.EntryKindFile:
+			files = append(files, entry.CanonicalPath)
+		}
+	}
+	for _, dirPath := range dirs {
+		assert.NoError(t, ex.ExtractEntry(dirPath, fsink))
+	}
+
+	const numWorkers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < len(files); j += numWorkers {
+				assert.NoError(t, ex.ExtractEntry(files[j], fsink))
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.NoError(t, fsink.Close())
+
+	for _, item := range sink.Items {
+		if item.Entry.Kind != savior.EntryKindFile {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(item.Entry.CanonicalPath)))
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(item.Data, data), "%s should have the right contents", item.Entry.CanonicalPath)
+	}
+
+	// getting a writer doesn't close anyone else's
+	a, err := fsink.GetWriter(&savior.Entry{CanonicalPath: "a.txt", Kind: savior.EntryKindFile, Mode: 0644})
+	assert.NoError(t, err)
+	b, err := fsink.GetWriter(&savior.Entry{CanonicalPath: "b.txt", Kind: savior.EntryKindFile, Mode: 0644})
+	assert.NoError(t, err)
+	_, err = a.Write([]byte("still open"))
+	assert.NoError(t, err)
+	assert.NoError(t, b.Close())
+
+	// ..but closing the sink closes them all
+	assert.NoError(t, fsink.Close())
+	_, err = a.Write([]byte("closed now"))
+	assert.Error(t, err)
+}
+
+func TestZipAppendedToExecutable(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "game/data.pak", data: "payload"},
+	})
+
+	stub := bytes.Repeat([]byte("MZ stub "), 1000)
+	exeBytes := append(append([]byte{}, stub...), zipBytes...)
+	reader := bytes.NewReader(exeBytes)
+
+	offset, size, err := zipextractor.FindZipOffset(reader, int64(len(exeBytes)))
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(stub), offset)
+	assert.EqualValues(t, len(zipBytes), size)
+
+	ex, err := zipextractor.NewAtOffset(reader, offset, size)
+	assert.NoError(t, err)
+
+	data, err := ex.ReadN("game/data.pak", 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, "payload", string(data))
+}
+
+func TestZipPathMapper(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "bin/Game.EXE", data: "game"},
+		{name: "README.txt", data: "readme"},
+		{name: "extras/evil.txt", data: "evil"},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-mapper")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetPathMapper(func(entry *savior.Entry) string {
+		switch {
+		case entry.CanonicalPath == "README.txt":
+			return ""
+		case strings.HasPrefix(entry.CanonicalPath, "extras/"):
+			return "../../" + entry.CanonicalPath
+		default:
+			return "usr/" + strings.ToLower(entry.CanonicalPath)
+		}
+	})
+
+	_, err = ex.Resume(nil, &savior.FolderSink{
+		Directory: filepath.Join(dir, "x", "out"),
+		Consumer:  &state.Consumer{},
+	})
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "x", "out", "usr", "bin", "game.exe"))
+	assert.NoError(t, err)
+	assert.Equal(t, "game", string(data))
+
+	for _, name := range []string{"x/out/README.txt", "extras/evil.txt"} {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		assert.True(t, os.IsNotExist(err), "%s should not have been extracted", name)
+	}
+}
+
+func TestZipStreamed(t *testing.T) {
+	// produced by Info-ZIP with `zip -r - . | cat > streamed.zip`,
+	// every entry has a data descriptor
+	zipBytes, err := ioutil.ReadFile(filepath.Join("testdata", "streamed.zip"))
+	assert.NoError(t, err)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	assert.Equal(t, savior.ResumeSupportBlock, ex.Features().ResumeSupport)
+
+	dir, res := extractRawZip(t, zipBytes)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "x", "out")
+
+	assert.Equal(t, 3, countEntries(res, savior.EntryKindFile))
+
+	data, err := ioutil.ReadFile(filepath.Join(out, "tiny.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "tiny\n", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(out, "empty.txt"))
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	data, err = ioutil.ReadFile(filepath.Join(out, "docs", "big.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("hello streamed world\n", 200), string(data))
+}
+
+type stopAfterSaves struct {
+	saves      int
+	checkpoint *savior.ExtractorCheckpoint
+}
+
+func (s *stopAfterSaves) ShouldSave(n int64) bool {
+	return true
+}
+
+func (s *stopAfterSaves) Save(checkpoint *savior.ExtractorCheckpoint) (savior.AfterSaveAction, error) {
+	// extractors reuse checkpoints, so keep a copy, like a real save consumer would
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(checkpoint)
+	if err != nil {
+		return savior.AfterSaveStop, err
+	}
+	s.checkpoint = nil
+	err = gob.NewDecoder(buf).Decode(&s.checkpoint)
+	if err != nil {
+		return savior.AfterSaveStop, err
+	}
+
+	s.saves--
+	if s.saves <= 0 {
+		return savior.AfterSaveStop, nil
+	}
+	return savior.AfterSaveContinue, nil
+}
+
+func TestZipVerifyArchive(t *testing.T) {
+	// random data doesn't compress, so the archive spans several reads
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0xf00d)).Read(data)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "big.bin", data: string(data)},
+	})
+	expected := sha256.Sum256(zipBytes)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	assert.NoError(t, ex.VerifyArchive(expected[:]))
+
+	err = ex.VerifyArchive(make([]byte, sha256.Size))
+	_, ok := err.(*zipextractor.ErrArchiveDigest)
+	assert.True(t, ok, "should fail with a digest error")
+
+	// stop after the first save, then resume from there
+	sc := &stopAfterSaves{saves: 1}
+	ex.SetSaveConsumer(sc)
+	assert.Equal(t, savior.ErrStop, ex.VerifyArchive(expected[:]))
+	assert.NotNil(t, sc.checkpoint)
+	assert.True(t, sc.checkpoint.Progress < 1.0)
+
+	ex.SetSaveConsumer(savior.NopSaveConsumer())
+	assert.NoError(t, ex.ResumeVerifyArchive(sc.checkpoint, expected[:]))
+
+	// cancel as soon as some progress is reported
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var lastProgress float64
+	ex.SetConsumer(&state.Consumer{
+		OnProgress: func(progress float64) {
+			lastProgress = progress
+			cancel()
+		},
+	})
+	assert.Equal(t, context.Canceled, ex.VerifyArchiveContext(ctx, expected[:]))
+	assert.True(t, lastProgress > 0 && lastProgress < 1.0)
+}
+
+// halvingSink only vouches for half of what checkpoints claim
+type halvingSink struct {
+	*savior.FolderSink
+}
+
+var _ savior.VerifyingSink = (*halvingSink)(nil)
+
+func (hs *halvingSink) VerifyEntry(entry *savior.Entry) (int64, error) {
+	return entry.WriteOffset / 2, nil
+}
+
+func TestZipVerifyingSink(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0xbeef)).Read(data)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "big.bin", data: string(data)},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-verifying")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+
+	sink := &halvingSink{&savior.FolderSink{Directory: dir}}
+
+	sc := &stopAfterSaves{saves: 2}
+	ex.SetSaveConsumer(sc)
+	_, err = ex.Resume(nil, sink)
+	assert.Equal(t, savior.ErrStop, err)
+	assert.NotNil(t, sc.checkpoint)
+	writeOffset := sc.checkpoint.Entry.WriteOffset
+	assert.True(t, writeOffset > 0, "should stop in the middle of big.bin")
+
+	// clobber what the sink doesn't vouch for: it must be written again
+	f, err := os.OpenFile(filepath.Join(dir, "big.bin"), os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, writeOffset-writeOffset/2), writeOffset/2)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	ex.SetSaveConsumer(savior.NopSaveConsumer())
+	_, err = ex.Resume(sc.checkpoint, sink)
+	assert.NoError(t, err)
+
+	actual, err := ioutil.ReadFile(filepath.Join(dir, "big.bin"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, actual), "big.bin should be intact")
+}
+
+func TestZipPasswordCallback(t *testing.T) {
+	// WinZip AES-256 (AE-1), password is "hunter2"
+	zipBytes, err := ioutil.ReadFile(filepath.Join("testdata", "aes256.zip"))
+	assert.NoError(t, err)
+
+	extract := func(callback savior.PasswordCallback) (string, error) {
+		dir, err := ioutil.TempDir("", "zipextractor-password")
+		assert.NoError(t, err)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetPasswordCallback(callback)
+
+		_, err = ex.Resume(nil, &savior.FolderSink{
+			Directory: dir,
+			Consumer:  &state.Consumer{},
+		})
+		return dir, err
+	}
+
+	var attempts []int
+	dir, err := extract(func(attempt int) (string, error) {
+		attempts = append(attempts, attempt)
+		if attempt == 0 {
+			return "hunter1", nil
+		}
+		return "hunter2", nil
+	})
+	defer os.RemoveAll(dir)
+	assert.NoError(t, err)
+	// the password is only asked for until it's right, then reused
+	assert.EqualValues(t, []int{0, 1}, attempts)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "secret", "stored.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "the cake is a lie\n", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, "secret", "deflated.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("all work and no play makes jack a dull boy\n", 500), string(data))
+
+	dir, err = extract(func(attempt int) (string, error) {
+		return "letmein", nil
+	})
+	defer os.RemoveAll(dir)
+	assert.True(t, errors.Is(err, savior.ErrBadPassword))
+
+	errCanceled := errors.New("canceled")
+	dir, err = extract(func(attempt int) (string, error) {
+		return "", errCanceled
+	})
+	defer os.RemoveAll(dir)
+	assert.True(t, errors.Is(err, errCanceled))
+}
+
+func TestZipMixedPasswords(t *testing.T) {
+	// WinZip AES-256 (AE-1), entries are encrypted with the password
+	// named after their folder
+	zipBytes, err := ioutil.ReadFile(filepath.Join("testdata", "aes256-mixed.zip"))
+	assert.NoError(t, err)
+
+	extract := func(setup func(ex *zipextractor.ZipExtractor)) (string, error) {
+		dir, err := ioutil.TempDir("", "zipextractor-password")
+		assert.NoError(t, err)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetConsumer(&state.Consumer{})
+		setup(ex)
+
+		_, err = ex.Resume(nil, &savior.FolderSink{
+			Directory: dir,
+			Consumer:  &state.Consumer{},
+		})
+		return dir, err
+	}
+
+	assertContents := func(dir string, path string, expected string) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(data))
+	}
+
+	// entries none of the candidates work for fail on their own
+	dir, err := extract(func(ex *zipextractor.ZipExtractor) {
+		ex.SetPasswords([]string{"alpha", "bravo"})
+		ex.SetErrorPolicy(savior.ErrorPolicyCollectAndContinue)
+	})
+	defer os.RemoveAll(dir)
+	if me, ok := err.(*savior.MultiError); assert.True(t, ok, "should fail with a MultiError, got %v", err) {
+		if assert.Len(t, me.Entries, 1) {
+			assert.Equal(t, "zulu/four.txt", me.Entries[0].CanonicalPath)
+			assert.True(t, errors.Is(me.Entries[0].Err, savior.ErrBadPassword))
+		}
+	}
+	assertContents(dir, "alpha/one.txt", "first, under alpha\n")
+	assertContents(dir, "bravo/two.txt", "second, under bravo\n")
+	assertContents(dir, "alpha/three.txt", "third, under alpha again\n")
+
+	// the callback is only asked about entries no known password works for
+	var asked []string
+	dir, err = extract(func(ex *zipextractor.ZipExtractor) {
+		ex.SetEntryPasswordCallback(func(entry *savior.Entry, attempt int) (string, error) {
+			asked = append(asked, entry.CanonicalPath)
+			return strings.Split(entry.CanonicalPath, "/")[0], nil
+		})
+	})
+	defer os.RemoveAll(dir)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"alpha/one.txt", "bravo/two.txt", "zulu/four.txt"}, asked)
+	assertContents(dir, "alpha/three.txt", "third, under alpha again\n")
+	assertContents(dir, "zulu/four.txt", "fourth, under a password nobody knows\n")
+}
+
+func TestZipEncryptedWithoutPassword(t *testing.T) {
+	zipBytes, err := ioutil.ReadFile(filepath.Join("testdata", "aes256.zip"))
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "zipextractor-encrypted")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+
+	manifest, err := ex.Manifest()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, manifest.NumEncrypted)
+
+	sink := &savior.FolderSink{
+		Directory: dir,
+		Consumer:  &state.Consumer{},
+	}
+
+	_, err = ex.Resume(nil, sink)
+	encErr, ok := err.(*savior.ErrEncrypted)
+	if assert.True(t, ok, "should fail with ErrEncrypted, got %v", err) {
+		var paths []string
+		for _, entry := range encErr.Entries {
+			paths = append(paths, entry.CanonicalPath)
+		}
+		assert.EqualValues(t, []string{"secret/stored.txt", "secret/deflated.txt"}, paths)
+	}
+
+	// nothing was written, not even preallocated
+	_, err = os.Stat(filepath.Join(dir, "secret", "stored.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = ex.ExtractEntry("secret/stored.txt", sink)
+	_, ok = err.(*savior.ErrEncrypted)
+	assert.True(t, ok)
+}
+
+func TestZipSpanned(t *testing.T) {
+	// made by Info-ZIP with `zip -0 -s 64k -r spanned.zip data docs`,
+	// data/big.txt starts in spanned.z01 and ends in spanned.zip,
+	// docs/readme.txt is entirely in spanned.zip
+	zipPath := filepath.Join("testdata", "spanned.zip")
+	paths, err := zipextractor.SpannedVolumePaths(zipPath)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{filepath.Join("testdata", "spanned.z01"), zipPath}, paths)
+
+	var volumes []zipextractor.Volume
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		assert.NoError(t, err)
+		volumes = append(volumes, zipextractor.Volume{
+			Name:     p,
+			ReaderAt: bytes.NewReader(data),
+			Size:     int64(len(data)),
+		})
+	}
+
+	ex, err := zipextractor.NewSpanned(volumes)
+	assert.NoError(t, err)
+	assert.NoError(t, ex.Validate())
+
+	dir, err := ioutil.TempDir("", "zipextractor-spanned")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	res, err := ex.Resume(nil, &savior.FolderSink{Directory: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countEntries(res, savior.EntryKindFile))
+
+	var expected bytes.Buffer
+	for i := 0; i < 7000; i++ {
+		fmt.Fprintf(&expected, "line %05d\n", i)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "data", "big.txt"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(expected.Bytes(), data), "big.txt should span both volumes intact")
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, "docs", "readme.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello spanned world\n", string(data))
+
+	// the last volume alone isn't enough
+	_, err = zipextractor.NewSpanned(volumes[1:])
+	assert.Error(t, err)
+
+	missingDir, err := ioutil.TempDir("", "zipextractor-spanned-missing")
+	assert.NoError(t, err)
+	defer os.RemoveAll(missingDir)
+	lonelyPath := filepath.Join(missingDir, "spanned.zip")
+	zipBytes, err := ioutil.ReadFile(zipPath)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(lonelyPath, zipBytes, 0644))
+	_, err = zipextractor.SpannedVolumePaths(lonelyPath)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "spanned.z01")
+	}
+}
+
+func TestZipTimestamps(t *testing.T) {
+	open := func(name string) *savior.Entry {
+		zipBytes, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		assert.NoError(t, err)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+
+		entries := ex.List()
+		assert.Len(t, entries, 1)
+		return entries[0]
+	}
+
+	// made by Info-ZIP's zip, which stores a UT extra field
+	entry := open("infozip-timestamps.zip")
+	assert.Equal(t, time.Date(2017, 5, 4, 3, 2, 1, 0, time.UTC), entry.ModTime)
+	// the access time is only in the local header
+	assert.True(t, entry.AccessTime.IsZero())
+
+	// laid out like Windows archivers do, with an NTFS extra field,
+	// and a UT field that disagrees with it
+	entry = open("ntfs-timestamps.zip")
+	assert.Equal(t, "Documents/report.txt", entry.CanonicalPath)
+	assert.Equal(t, time.Date(2019, 6, 7, 8, 9, 10, 123456700, time.UTC), entry.ModTime)
+	assert.Equal(t, time.Date(2019, 6, 8, 1, 2, 3, 0, time.UTC), entry.AccessTime)
+	assert.Equal(t, time.Date(2019, 1, 1, 0, 0, 0, 500, time.UTC), entry.ChangeTime)
+}
+
+func TestZipValidate(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "ok.txt", data: "fine"},
+		{name: "broken.txt", data: strings.Repeat("soon to be corrupted ", 100)},
+	})
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	assert.NoError(t, ex.Validate())
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	dataOff, err := zr.File[1].DataOffset()
+	assert.NoError(t, err)
+	zipBytes[dataOff+int64(zr.File[1].CompressedSize64)/2] ^= 0xff
+
+	ex, err = zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	err = ex.Validate()
+	if ce, ok := err.(*zipextractor.ErrCorruptEntry); assert.True(t, ok, "should fail with a corrupt entry error") {
+		assert.Equal(t, "broken.txt", ce.Entry.CanonicalPath)
+	}
+}
+
+func TestZipQuickCheck(t *testing.T) {
+	makeZip := func() []byte {
+		return makeRawZip(t, []zipItem{
+			{name: "first.txt", data: "fine"},
+			{name: "second.txt", data: strings.Repeat("soon to be corrupted ", 100)},
+		})
+	}
+	quickCheck := func(zipBytes []byte) error {
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		return ex.QuickCheck()
+	}
+	assertCorrupt := func(err error, name string) {
+		if ce, ok := err.(*zipextractor.ErrCorruptEntry); assert.True(t, ok, "should fail with a corrupt entry error") {
+			assert.Equal(t, name, ce.Entry.CanonicalPath)
+		}
+	}
+
+	zipBytes := makeZip()
+	assert.NoError(t, quickCheck(zipBytes))
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	first := zr.File[0].HeaderOffset()
+	second := zr.File[1].HeaderOffset()
+	dataOff, err := zr.File[1].DataOffset()
+	assert.NoError(t, err)
+
+	// data isn't decompressed, so corrupt data goes unnoticed
+	zipBytes[dataOff+int64(zr.File[1].CompressedSize64)/2] ^= 0xff
+	assert.NoError(t, quickCheck(zipBytes))
+
+	zipBytes = makeZip()
+	zipBytes[second] = 'X'
+	assertCorrupt(quickCheck(zipBytes), "second.txt")
+
+	zipBytes = makeZip()
+	binary.LittleEndian.PutUint16(zipBytes[first+8:], zip.Store)
+	assertCorrupt(quickCheck(zipBytes), "first.txt")
+
+	// as if the central directory belonged to a longer archive
+	zipBytes = makeZip()
+	centralHeader := bytes.LastIndex(zipBytes, []byte("PK\x01\x02"))
+	binary.LittleEndian.PutUint32(zipBytes[centralHeader+20:], 1024*1024)
+	assertCorrupt(quickCheck(zipBytes), "second.txt")
+}
+
+func TestZipResumeDoneEntries(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "first"},
+		{name: "b.txt", data: "second"},
+		{name: "c.txt", data: "third"},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+
+	// as if b.txt had been done first, out of order
+	checkpoint := &savior.ExtractorCheckpoint{}
+	checkpoint.DoneEntries.Set(1)
+
+	res, err := ex.Resume(checkpoint, &savior.FolderSink{Directory: dir})
+	assert.NoError(t, err)
+	// the result still lists every entry of the archive
+	assert.Equal(t, 3, countEntries(res, savior.EntryKindFile))
+
+	for _, name := range []string{"a.txt", "c.txt"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.NoError(t, err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "b.txt"))
+	assert.True(t, os.IsNotExist(err), "b.txt should be skipped")
+	assert.False(t, res.ResumedFromComplete)
+
+	// everything's done now, resuming again does nothing
+	checkpoint = &savior.ExtractorCheckpoint{EntryIndex: 3}
+	res, err = ex.Resume(checkpoint, &savior.FolderSink{Directory: dir})
+	assert.NoError(t, err)
+	assert.True(t, res.ResumedFromComplete)
+	assert.Equal(t, 3, countEntries(res, savior.EntryKindFile))
+
+	res, err = ex.Resume(nil, &savior.FolderSink{Directory: dir})
+	assert.NoError(t, err)
+	assert.False(t, res.ResumedFromComplete)
+}
+
+func TestZipMaxEntries(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "first"},
+		{name: "b.txt", data: "second"},
+		{name: "c.txt", data: "third"},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-maxentries")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetMaxEntries(2)
+
+	_, err = ex.Resume(nil, &savior.FolderSink{Directory: dir})
+	tmErr, ok := err.(*savior.ErrTooManyEntries)
+	if assert.True(t, ok, "should fail with ErrTooManyEntries, got %v", err) {
+		assert.EqualValues(t, 3, tmErr.Count)
+	}
+
+	// nothing was written
+	_, err = os.Stat(filepath.Join(dir, "a.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	ex.SetMaxEntries(3)
+	_, err = ex.Resume(nil, &savior.FolderSink{Directory: dir})
+	assert.NoError(t, err)
+}
+
+// dirSyncRecordingSink records which directories were synced
+type dirSyncRecordingSink struct {
+	*savior.FolderSink
+	synced []string
+}
+
+func (ds *dirSyncRecordingSink) SyncDir(canonicalPath string) error {
+	ds.synced = append(ds.synced, canonicalPath)
+	return ds.FolderSink.SyncDir(canonicalPath)
+}
+
+func TestZipSyncDirs(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a/b/deep.txt", data: "deep"},
+		{name: "a/shallow.txt", data: "shallow"},
+		{name: "c/", data: ""},
+		{name: "root.txt", data: "root"},
+	})
+
+	extract := func(syncDirs bool) []string {
+		dir, err := ioutil.TempDir("", "zipextractor-syncdirs")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetSyncDirs(syncDirs)
+
+		sink := &dirSyncRecordingSink{FolderSink: &savior.FolderSink{Directory: dir}}
+		_, err = ex.Resume(nil, sink)
+		assert.NoError(t, err)
+		return sink.synced
+	}
+
+	assert.Empty(t, extract(false))
+	assert.EqualValues(t, []string{"a/b", "a", "."}, extract(true))
+
+	// sinks that can't sync directories get a warning
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetSyncDirs(true)
+
+	var warnings []string
+	ex.SetConsumer(&state.Consumer{
+		OnMessage: func(lvl string, msg string) {
+			if lvl == "warning" {
+				warnings = append(warnings, msg)
+			}
+		},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-syncdirs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = ex.Resume(nil, &savior.PrefixSink{
+		Prefix: "sub",
+		Sink:   &savior.FolderSink{Directory: dir},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, warnings, 1) {
+		assert.Contains(t, warnings[0], "sync directories")
+	}
+}
+
+func TestZipVerbose(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "first"},
+	})
+
+	extract := func(verbose bool) []string {
+		dir, err := ioutil.TempDir("", "zipextractor-verbose")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetVerbose(verbose)
+
+		var messages []string
+		ex.SetConsumer(&state.Consumer{
+			OnMessage: func(lvl string, msg string) {
+				messages = append(messages, msg)
+			},
+		})
+
+		_, err = ex.Resume(nil, &savior.FolderSink{Directory: dir})
+		assert.NoError(t, err)
+		return messages
+	}
+
+	hasPrealloc := func(messages []string) bool {
+		for _, msg := range messages {
+			if strings.Contains(msg, "Pre-allocat") {
+				return true
+			}
+		}
+		return false
+	}
+
+	assert.False(t, hasPrealloc(extract(false)), "quiet by default")
+	assert.True(t, hasPrealloc(extract(true)))
+}
+
+// stallingReaderAt never returns reads that touch [start, end), once armed
+type stallingReaderAt struct {
+	r          *bytes.Reader
+	start, end int64
+	armed      bool
+	unblock    chan struct{}
+}
+
+func (s *stallingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if s.armed && off < s.end && off+int64(len(p)) > s.start {
+		<-s.unblock
+	}
+	return s.r.ReadAt(p, off)
+}
+
+func TestZipEntryTimeout(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "fine"},
+		{name: "b.txt", data: strings.Repeat("stuck ", 100)},
+		{name: "c.txt", data: "also fine"},
+	})
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	dataOff, err := zr.File[1].DataOffset()
+	assert.NoError(t, err)
+
+	extract := func(policy savior.EntryTimeoutPolicy) (string, *savior.ExtractorResult, error) {
+		stalling := &stallingReaderAt{
+			r:       bytes.NewReader(zipBytes),
+			start:   dataOff,
+			end:     dataOff + int64(zr.File[1].CompressedSize64),
+			unblock: make(chan struct{}),
+		}
+		defer close(stalling.unblock)
+
+		dir, err := ioutil.TempDir("", "zipextractor-test")
+		assert.NoError(t, err)
+
+		ex, err := zipextractor.New(stalling, int64(len(zipBytes)))
+		assert.NoError(t, err)
+		stalling.armed = true
+		ex.SetConsumer(&state.Consumer{})
+		ex.SetEntryTimeout(50 * time.Millisecond)
+		ex.SetEntryTimeoutPolicy(policy)
+
+		res, err := ex.Resume(nil, &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+		return dir, res, err
+	}
+
+	dir, _, err := extract(savior.EntryTimeoutPolicyFail)
+	defer os.RemoveAll(dir)
+	if te, ok := savior.UnwrapError(err).(*savior.ErrEntryTimeout); assert.True(t, ok, "should fail with an entry timeout") {
+		assert.Equal(t, "b.txt", te.Entry.CanonicalPath)
+	}
+
+	dir, res, err := extract(savior.EntryTimeoutPolicySkip)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	outcomes := make(map[string]savior.EntryOutcome)
+	for _, entry := range res.Entries {
+		outcomes[entry.CanonicalPath] = entry.Outcome
+		if entry.CanonicalPath == "b.txt" {
+			_, ok := entry.Err.(*savior.ErrEntryTimeout)
+			assert.True(t, ok, "failed entry should carry its error")
+		}
+	}
+	assert.Equal(t, map[string]savior.EntryOutcome{
+		"a.txt": savior.EntryOutcomeWritten,
+		"b.txt": savior.EntryOutcomeFailed,
+		"c.txt": savior.EntryOutcomeWritten,
+	}, outcomes)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "c.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "also fine", string(contents))
+}
+
+func TestZipEstimateDuration(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:   fmt.Sprintf("method-%d.bin", method),
+			Method: method,
+		})
+		assert.NoError(t, err)
+		_, err = w.Write(bytes.Repeat([]byte{0x42}, 1000*1000))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+
+	ex, err := zipextractor.New(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+
+	// 1MB of deflate at 1MB/s, plus 1MB stored, which is faster
+	assert.Equal(t, 1250*time.Millisecond, ex.EstimateDuration(1000*1000))
+	assert.Equal(t, time.Duration(0), ex.EstimateDuration(0))
+}
+
+func TestZipThroughput(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:   fmt.Sprintf("method-%d.bin", method),
+			Method: method,
+		})
+		assert.NoError(t, err)
+		_, err = w.Write(bytes.Repeat([]byte{0x42}, 1000*1000))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+
+	res, err := ex.Resume(nil, &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+	assert.NoError(t, err)
+
+	assert.Len(t, res.Throughput, 2)
+	for _, method := range []savior.CompressionMethod{savior.CompressionMethodStore, savior.CompressionMethodDeflate} {
+		stat := res.Throughput[method]
+		assert.EqualValues(t, 1000*1000, stat.Bytes)
+		assert.True(t, stat.Duration > 0)
+		assert.True(t, stat.BytesPerSecond() > 0)
+	}
+
+	methods := make(map[string]savior.CompressionMethod)
+	for _, entry := range ex.List() {
+		methods[entry.CanonicalPath] = entry.Method
+	}
+	assert.Equal(t, savior.CompressionMethodStore, methods["method-0.bin"])
+	assert.Equal(t, savior.CompressionMethodDeflate, methods["method-8.bin"])
+}
+
+func TestCompressionMethod(t *testing.T) {
+	assert.Equal(t, "deflate", savior.CompressionMethodDeflate.String())
+	assert.Equal(t, "zstd", savior.CompressionMethodZstd.String())
+	assert.Equal(t, "method-42", savior.CompressionMethod(42).String())
+
+	assert.True(t, savior.CompressionMethodStore.Resumable())
+	assert.True(t, savior.CompressionMethodLZMA.Supported())
+	assert.False(t, savior.CompressionMethodLZMA.Resumable())
+	assert.False(t, savior.CompressionMethodBzip2.Supported())
+	assert.False(t, savior.CompressionMethodWinZipAES.Supported())
+}
+
+func TestZipNewFromReader(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "first.txt", data: "one"},
+		{name: "last.txt", data: "two"},
+	})
+	otherBytes := makeRawZip(t, []zipItem{
+		{name: "unrelated.txt", data: "three"},
+	})
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+
+	ex, err := zipextractor.NewFromReader(zr, bytes.NewReader(zipBytes))
+	assert.NoError(t, err)
+	assert.Len(t, ex.List(), 2)
+
+	_, err = zipextractor.NewFromReader(zr, bytes.NewReader(otherBytes))
+	assert.Error(t, err, "should notice the reader doesn't match")
+}
+
+// seekerOnly hides everything but Read and Seek
+type seekerOnly struct {
+	io.ReadSeeker
+}
+
+func TestZipNewFromSeeker(t *testing.T) {
+	sink := checker.MakeTestSinkAdvanced(20)
+	zipBytes := checker.MakeZip(t, sink)
+
+	ex, err := zipextractor.NewFromSeeker(&seekerOnly{bytes.NewReader(zipBytes)})
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+
+	sink.Reset()
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Validate())
+
+	_, err = zipextractor.NewFromSeeker(&seekerOnly{bytes.NewReader([]byte("not a zip"))})
+	assert.Error(t, err)
+}
+
+func TestZipRecursive(t *testing.T) {
+	innermost := makeRawZip(t, []zipItem{
+		{name: "deepest.txt", data: "too deep"},
+	})
+	inner := makeRawZip(t, []zipItem{
+		{name: "payload.txt", data: "the payload"},
+		{name: "innermost.zip", data: string(innermost)},
+	})
+	outer := makeRawZip(t, []zipItem{
+		{name: "readme.txt", data: "not an archive"},
+		{name: "data/inner.zip", data: string(inner)},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(outer), int64(len(outer)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetRecursive(1)
+
+	res, err := ex.Resume(nil, &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+	assert.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "data", "inner", "payload.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "the payload", string(contents))
+
+	// past the maximum depth, archives are written as-is
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "data", "inner", "innermost.zip"))
+	assert.NoError(t, err)
+	assert.Equal(t, innermost, contents)
+
+	_, err = os.Stat(filepath.Join(dir, "data", "inner.zip"))
+	assert.True(t, os.IsNotExist(err), "nested archive itself shouldn't be written")
+
+	if nestedRes, ok := res.Nested["data/inner.zip"]; assert.True(t, ok) {
+		assert.Equal(t, 2, countEntries(nestedRes, savior.EntryKindFile))
+		assert.Empty(t, nestedRes.Nested)
+	}
+	for _, entry := range res.Entries {
+		if entry.CanonicalPath == "data/inner.zip" {
+			assert.Equal(t, savior.EntryOutcomeNested, entry.Outcome)
+		}
+	}
+}
+
+func TestZipContentTransform(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "game.ini", data: "path=${INSTALL_DIR}/data\n"},
+		{name: "data/game.dat", data: strings.Repeat("${INSTALL_DIR}", 1024)},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetContentTransform(func(entry *savior.Entry) bool {
+		return strings.HasSuffix(entry.CanonicalPath, ".ini")
+	}, func(r io.Reader) io.Reader {
+		contents, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		return strings.NewReader(strings.Replace(string(contents), "${INSTALL_DIR}", "/opt/game", -1))
+	})
+
+	sink := &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "game.ini"))
+	assert.NoError(t, err)
+	assert.Equal(t, "path=/opt/game/data\n", string(contents))
+
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "data", "game.dat"))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("${INSTALL_DIR}", 1024), string(contents))
+
+	diff, err := ex.Diff(sink)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"game.ini"}, diff.Changed)
+	assert.EqualValues(t, []string{"data/game.dat"}, diff.Unchanged)
+}
+
+func TestZipDiffArchives(t *testing.T) {
+	open := func(items []zipItem) *zipextractor.ZipExtractor {
+		zipBytes := makeRawZip(t, items)
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		return ex
+	}
+
+	old := open([]zipItem{
+		{name: "data/", data: ""},
+		{name: "data/same.dat", data: "same"},
+		{name: "data/changed.dat", data: "before"},
+		{name: "gone.txt", data: "gone"},
+		{name: "b.txt", data: "b"},
+	})
+	new := open([]zipItem{
+		{name: "data/", data: ""},
+		{name: "data/same.dat", data: "same"},
+		{name: "data/changed.dat", data: "after!"},
+		{name: "z.txt", data: "z"},
+		{name: "a.txt", data: "a"},
+		{name: "b.txt", data: "c"},
+	})
+
+	diff, err := zipextractor.DiffArchives(old, new)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"a.txt", "z.txt"}, diff.Added)
+	assert.EqualValues(t, []string{"gone.txt"}, diff.Removed)
+	assert.EqualValues(t, []string{"b.txt", "data/changed.dat"}, diff.Modified)
+}
+
+func TestZipRecoveryManifest(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "first"},
+		{name: "b.txt", data: "second"},
+		{name: "c.txt", data: "third"},
+		{name: "d.txt", data: "fourth"},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	manifestPath := filepath.Join(dir, "recovery.jsonl")
+	outDir := filepath.Join(dir, "out")
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetRecoveryManifest(manifestPath)
+
+	sink := &savior.FolderSink{Directory: outDir, Consumer: &state.Consumer{}}
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err)
+
+	rm := &savior.RecoveryManifest{Path: manifestPath}
+	records, err := rm.Records()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 4) {
+		for _, record := range records {
+			assert.True(t, record.Complete, "%s should be complete", record.CanonicalPath)
+		}
+		assert.EqualValues(t, 5, records[0].Size)
+	}
+
+	// as if the output had been damaged after a crash
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outDir, "a.txt"), []byte("fir"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outDir, "b.txt"), []byte("SECOND"), 0644))
+	assert.NoError(t, os.Remove(filepath.Join(outDir, "c.txt")))
+
+	scan, err := rm.Scan(sink, false)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"b.txt", "d.txt"}, scan.Complete)
+	assert.EqualValues(t, []string{"a.txt"}, scan.Partial)
+	assert.EqualValues(t, []string{"c.txt"}, scan.Missing)
+
+	scan, err = rm.Scan(sink, true)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"d.txt"}, scan.Complete)
+	assert.EqualValues(t, []string{"a.txt", "b.txt"}, scan.Partial)
+}
+
+func TestZipCompatibility(t *testing.T) {
+	clean := makeRawZip(t, []zipItem{
+		{name: "dir/", data: ""},
+		{name: "dir/a.txt", data: "fine"},
+	})
+	ex, err := zipextractor.New(bytes.NewReader(clean), int64(len(clean)))
+	assert.NoError(t, err)
+	report := ex.Compatibility()
+	assert.True(t, report.OK())
+	assert.False(t, report.Fatal())
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	nopCompressor := func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	}
+	zw.RegisterCompressor(zip.LZMA, nopCompressor)
+	zw.RegisterCompressor(98, nopCompressor)
+
+	for _, fh := range []*zip.FileHeader{
+		{Name: "a.txt", Method: zip.Deflate},
+		{Name: "b.lzma", Method: zip.LZMA},
+		{Name: "c.ppmd", Method: 98},
+		{Name: "d.ppmd", Method: 98},
+		{Name: "e.bin", Method: zip.Store, Flags: 0x1 | 0x40},
+		{Name: "f.bin", Method: zip.Store, Flags: 0x1},
+	} {
+		w, err := zw.CreateHeader(fh)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte("data"))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+
+	ex, err = zipextractor.New(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	report = ex.Compatibility()
+	assert.True(t, report.Fatal())
+
+	var lines []string
+	for _, issue := range report.Issues {
+		lines = append(lines, issue.String())
+	}
+	assert.EqualValues(t, []string{
+		"1 entry uses method 14 (lzma) — no resume",
+		"2 entries use method 98 (method-98) — not supported",
+		"1 entry uses strong encryption — not supported",
+		"1 entry uses traditional zip encryption — not supported",
+	}, lines)
+	assert.False(t, report.Issues[0].Fatal)
+	assert.True(t, report.Issues[1].Fatal)
+	assert.EqualValues(t, "c.ppmd", report.Issues[1].Entries[0].CanonicalPath)
+
+	// AES needs a password, and then only loses resume support
+	zipBytes, err := ioutil.ReadFile(filepath.Join("testdata", "aes256.zip"))
+	assert.NoError(t, err)
+	ex, err = zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+
+	report = ex.Compatibility()
+	assert.Equal(t, "2 entries use method 99 (aes) — password required", report.String())
+	assert.True(t, report.Fatal())
+
+	ex.SetPasswordCallback(func(attempt int) (string, error) {
+		return "hunter2", nil
+	})
+	report = ex.Compatibility()
+	assert.Equal(t, "2 entries use method 99 (aes) — no resume", report.String())
+	assert.False(t, report.Fatal())
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// refusingSink can't write some of the entries
+type refusingSink struct {
+	*savior.FolderSink
+	refused map[string]bool
+}
+
+func (rs *refusingSink) GetWriter(entry *savior.Entry) (savior.EntryWriter, error) {
+	if rs.refused[entry.CanonicalPath] {
+		return nil, fmt.Errorf("refusing to write %s", entry.CanonicalPath)
+	}
+	return rs.FolderSink.GetWriter(entry)
+}
+
+func TestZipErrorPolicy(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "fine"},
+		{name: "b.txt", data: "refused"},
+		{name: "c.txt", data: "also fine"},
+		{name: "d.txt", data: "also refused"},
+	})
+
+	extract := func(policy savior.ErrorPolicy) (string, *savior.ExtractorResult, error) {
+		dir, err := ioutil.TempDir("", "zipextractor-test")
+		assert.NoError(t, err)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetConsumer(&state.Consumer{})
+		ex.SetErrorPolicy(policy)
+
+		sink := &refusingSink{
+			FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+			refused:    map[string]bool{"b.txt": true, "d.txt": true},
+		}
+		res, err := ex.Resume(nil, sink)
+		return dir, res, err
+	}
+
+	dir, res, err := extract(savior.ErrorPolicyFailFast)
+	defer os.RemoveAll(dir)
+	assert.Error(t, err)
+	assert.Nil(t, res)
+	// c.txt was preallocated, but never written
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "c.txt"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, "also fine", string(contents), "should stop at the first failure")
+
+	dir, res, err = extract(savior.ErrorPolicyCollectAndContinue)
+	defer os.RemoveAll(dir)
+	me, ok := err.(*savior.MultiError)
+	if assert.True(t, ok, "should fail with a MultiError, got %v", err) {
+		var paths []string
+		for _, entry := range me.Entries {
+			paths = append(paths, entry.CanonicalPath)
+			assert.Error(t, entry.Err)
+		}
+		assert.EqualValues(t, []string{"b.txt", "d.txt"}, paths)
+	}
+
+	// the partial result is still returned
+	if assert.NotNil(t, res) {
+		outcomes := make(map[string]savior.EntryOutcome)
+		for _, entry := range res.Entries {
+			outcomes[entry.CanonicalPath] = entry.Outcome
+		}
+		assert.Equal(t, map[string]savior.EntryOutcome{
+			"a.txt": savior.EntryOutcomeWritten,
+			"b.txt": savior.EntryOutcomeFailed,
+			"c.txt": savior.EntryOutcomeWritten,
+			"d.txt": savior.EntryOutcomeFailed,
+		}, outcomes)
+	}
+
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "c.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "also fine", string(contents))
+}
+
+func TestZipDiffCompareStrategy(t *testing.T) {
+	rng := rand.New(rand.NewSource(0xfeed))
+	contents := make(map[string][]byte)
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, fh := range []*zip.FileHeader{
+		{Name: "stored.bin", Method: zip.Store},
+		{Name: "deflated.bin", Method: zip.Deflate},
+		{Name: "small.txt", Method: zip.Deflate},
+	} {
+		data := make([]byte, 256*1024)
+		if fh.Name == "small.txt" {
+			data = make([]byte, 1024)
+		}
+		rng.Read(data)
+		contents[fh.Name] = data
+
+		w, err := zw.CreateHeader(fh)
+		assert.NoError(t, err)
+		_, err = w.Write(data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	sink := &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err)
+
+	// modify files in place, without changing their size
+	corrupt := func(name string, offset int) {
+		data := append([]byte(nil), contents[name]...)
+		data[offset] ^= 0xff
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0644))
+	}
+	corrupt("stored.bin", 128*1024)
+	corrupt("deflated.bin", 256*1024-1)
+	corrupt("small.txt", 512)
+
+	for _, tc := range []struct {
+		strategy zipextractor.CompareStrategy
+		changed  []string
+	}{
+		{zipextractor.CompareSizeOnly, nil},
+		{zipextractor.CompareSizeAndCRC, []string{"stored.bin", "deflated.bin", "small.txt"}},
+		// the change in the middle of stored.bin goes unnoticed
+		{zipextractor.CompareSizeAndSample, []string{"deflated.bin", "small.txt"}},
+	} {
+		ex.SetCompareStrategy(tc.strategy)
+		diff, err := ex.Diff(sink)
+		assert.NoError(t, err)
+		assert.EqualValues(t, tc.changed, diff.Changed, "with %s", tc.strategy)
+	}
+}
+
+// asAE2 turns the WinZip AES entries of a zip from version 1 into
+// version 2 of the format, which doesn't store a CRC32
+func asAE2(t *testing.T, zipBytes []byte) []byte {
+	ae1 := []byte{0x01, 0x99, 0x07, 0x00, 0x01, 0x00}
+	ae2 := []byte{0x01, 0x99, 0x07, 0x00, 0x02, 0x00}
+	assert.True(t, bytes.Contains(zipBytes, ae1), "should have AE-1 entries")
+	zipBytes = bytes.Replace(zipBytes, ae1, ae2, -1)
+
+	// CRC32 offsets in local headers, data descriptors and central
+	// directory headers
+	for sig, crcOffset := range map[uint32]int{
+		0x04034b50: 14,
+		0x08074b50: 4,
+		0x02014b50: 16,
+	} {
+		sigBytes := make([]byte, 4)
+		binary.LittleEndian.PutUint32(sigBytes, sig)
+		for off := 0; ; {
+			i := bytes.Index(zipBytes[off:], sigBytes)
+			if i < 0 {
+				break
+			}
+			off += i
+			binary.LittleEndian.PutUint32(zipBytes[off+crcOffset:], 0)
+			off += len(sigBytes)
+		}
+	}
+	return zipBytes
+}
+
+func TestZipDiffCompareStrategyAE2(t *testing.T) {
+	zipBytes, err := ioutil.ReadFile(filepath.Join("testdata", "aes256.zip"))
+	assert.NoError(t, err)
+	zipBytes = asAE2(t, zipBytes)
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetPasswords([]string{"hunter2"})
+	sink := &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err)
+
+	// the stored CRC32 is 0, but the decrypted contents still match
+	ex.SetCompareStrategy(zipextractor.CompareSizeAndCRC)
+	diff, err := ex.Diff(sink)
+	assert.NoError(t, err)
+	assert.Empty(t, diff.Changed)
+	assert.EqualValues(t, []string{"secret/stored.txt", "secret/deflated.txt"}, diff.Unchanged)
+
+	// ..and changes that keep the size are still caught
+	path := filepath.Join(dir, "secret", "stored.txt")
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	data[0] ^= 0xff
+	assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+
+	diff, err = ex.Diff(sink)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"secret/stored.txt"}, diff.Changed)
+	assert.EqualValues(t, []string{"secret/deflated.txt"}, diff.Unchanged)
+}
+
+// syncCheckingSink remembers which entries were closed with
+// writes that hadn't been synced
+type syncCheckingSink struct {
+	*savior.FolderSink
+	unsynced []string
+}
+
+func (scs *syncCheckingSink) GetWriter(entry *savior.Entry) (savior.EntryWriter, error) {
+	w, err := scs.FolderSink.GetWriter(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &syncCheckingWriter{EntryWriter: w, sink: scs, entry: entry}, nil
+}
+
+type syncCheckingWriter struct {
+	savior.EntryWriter
+	sink   *syncCheckingSink
+	entry  *savior.Entry
+	dirty  bool
+	closed bool
+}
+
+func (scw *syncCheckingWriter) Write(buf []byte) (int, error) {
+	scw.dirty = true
+	return scw.EntryWriter.Write(buf)
+}
+
+func (scw *syncCheckingWriter) Sync() error {
+	scw.dirty = false
+	return scw.EntryWriter.Sync()
+}
+
+func (scw *syncCheckingWriter) Close() error {
+	if scw.dirty && !scw.closed {
+		scw.sink.unsynced = append(scw.sink.unsynced, scw.entry.CanonicalPath)
+	}
+	scw.closed = true
+	return scw.EntryWriter.Close()
+}
+
+func TestZipSyncAtEntryEnd(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "first"},
+		{name: "b.txt", data: strings.Repeat("second", 1024)},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &syncCheckingSink{
+		FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+	}
+
+	// no checkpoints are saved, so nothing syncs but the end of entries
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err)
+	assert.Empty(t, sink.unsynced)
+
+	assert.NoError(t, ex.ExtractEntry("b.txt", sink))
+	assert.Empty(t, sink.unsynced)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "b.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("second", 1024), string(contents))
+}
+
+func TestZipResumeFromRemoteCopy(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0xcafe)).Read(data)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "big.bin", data: string(data)},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "game.zip", time.Time{}, bytes.NewReader(zipBytes))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sink := &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}
+
+	// start from a local copy...
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	sc := &stopAfterSaves{saves: 2}
+	ex.SetSaveConsumer(sc)
+	_, err = ex.Resume(nil, sink)
+	assert.Equal(t, savior.ErrStop, err)
+	assert.True(t, sc.checkpoint.Entry.WriteOffset > 0, "should stop in the middle of big.bin")
+	assert.EqualValues(t, len(zipBytes), sc.checkpoint.SourceSize)
+
+	// ...refuse to resume from another archive...
+	otherBytes := makeRawZip(t, []zipItem{
+		{name: "big.bin", data: string(data[1:])},
+	})
+	other, err := zipextractor.New(bytes.NewReader(otherBytes), int64(len(otherBytes)))
+	assert.NoError(t, err)
+	other.SetConsumer(&state.Consumer{})
+	_, err = other.Resume(sc.checkpoint, sink)
+	if sme, ok := err.(*savior.ErrSourceMismatch); assert.True(t, ok, "should fail with a source mismatch, got %v", err) {
+		assert.EqualValues(t, len(zipBytes), sme.Expected)
+		assert.EqualValues(t, len(otherBytes), sme.Actual)
+	}
+
+	// ...but resume from a remote copy of the same one
+	file, err := eos.Open(server.URL + "/game.zip")
+	assert.NoError(t, err)
+	defer file.Close()
+	stats, err := file.Stat()
+	assert.NoError(t, err)
+
+	remote, err := zipextractor.New(file, stats.Size())
+	assert.NoError(t, err)
+	remote.SetConsumer(&state.Consumer{})
+	_, err = remote.Resume(sc.checkpoint, sink)
+	assert.NoError(t, err)
+
+	actual, err := ioutil.ReadFile(filepath.Join(dir, "big.bin"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, actual), "big.bin should be intact")
+}
+
+func TestZipChecksumVerifier(t *testing.T) {
+	rng := rand.New(rand.NewSource(0xc4c))
+	data := make([]byte, 4*1024*1024)
+	rng.Read(data)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "stored.bin", Method: zip.Store})
+	assert.NoError(t, err)
+	_, err = w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sink := &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}
+
+	// stop in the middle of the entry, then resume: the part
+	// written before stopping is read back from the sink
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetChecksumVerifier(zipextractor.CRC32Verifier{})
+	sc := &stopAfterSaves{saves: 1}
+	ex.SetSaveConsumer(sc)
+	_, err = ex.Resume(nil, sink)
+	assert.True(t, errors.Is(err, savior.ErrStop))
+	if assert.NotNil(t, sc.checkpoint) && assert.NotNil(t, sc.checkpoint.Entry) {
+		assert.True(t, sc.checkpoint.Entry.WriteOffset > 0)
+	}
+
+	ex.SetSaveConsumer(savior.NopSaveConsumer())
+	_, err = ex.Resume(sc.checkpoint, sink)
+	assert.NoError(t, err)
+
+	// flip a byte in the middle of the stored data
+	corrupted := append([]byte(nil), zipBytes...)
+	corrupted[bytes.Index(corrupted, data[:64])+len(data)/2] ^= 0xff
+
+	ex, err = zipextractor.New(bytes.NewReader(corrupted), int64(len(corrupted)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	_, err = ex.Resume(nil, sink)
+	assert.NoError(t, err, "stored entries aren't checked by default")
+
+	ex.SetChecksumVerifier(zipextractor.CRC32Verifier{})
+	_, err = ex.Resume(nil, sink)
+	if ce, ok := savior.UnwrapError(err).(*zipextractor.ErrCorruptEntry); assert.True(t, ok, "should fail with a corrupt entry error") {
+		assert.Equal(t, "stored.bin", ce.Entry.CanonicalPath)
+	}
+}
+
+func TestZipProgressCallback(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x9a9))
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, name := range []string{"textures/hero.png", "textures/villain.png"} {
+		data := make([]byte, 2*1024*1024)
+		rng.Read(data)
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		assert.NoError(t, err)
+		_, err = w.Write(data)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var consumerCalls int
+	var infos []savior.ProgressInfo
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{
+		OnProgress: func(progress float64) {
+			consumerCalls++
+		},
+	})
+	ex.SetProgressCallback(func(info savior.ProgressInfo) {
+		infos = append(infos, info)
+	})
+	_, err = ex.Resume(nil, &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+	assert.NoError(t, err)
+
+	// the consumer still gets the bare progress
+	assert.Equal(t, consumerCalls, len(infos))
+
+	paths := make(map[string]bool)
+	var last float64
+	for _, info := range infos {
+		paths[info.EntryPath] = true
+		assert.True(t, info.Progress >= last, "overall progress shouldn't go backwards")
+		last = info.Progress
+		assert.True(t, info.Progress > 0 && info.Progress <= 1)
+		assert.True(t, info.EntryProgress > 0 && info.EntryProgress <= 1)
+		assert.True(t, info.BytesPerSecond >= 0)
+	}
+	assert.True(t, paths["textures/hero.png"])
+	assert.True(t, paths["textures/villain.png"])
+}
+
+// slowSink's writers take a while, like a throttled disk would
+type slowSink struct {
+	*savior.FolderSink
+}
+
+func (ss *slowSink) GetWriter(entry *savior.Entry) (savior.EntryWriter, error) {
+	w, err := ss.FolderSink.GetWriter(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &slowWriter{EntryWriter: w}, nil
+}
+
+type slowWriter struct {
+	savior.EntryWriter
+}
+
+func (sw *slowWriter) Write(buf []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return sw.EntryWriter.Write(buf)
+}
+
+func TestZipProgressWaits(t *testing.T) {
+	data := make([]byte, 4*1024*1024)
+	rand.New(rand.NewSource(0x5105)).Read(data)
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "big.bin", Method: zip.Store})
+	assert.NoError(t, err)
+	_, err = w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var infos []savior.ProgressInfo
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetProgressCallback(func(info savior.ProgressInfo) {
+		infos = append(infos, info)
+	})
+	_, err = ex.Resume(nil, &slowSink{FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}})
+	assert.NoError(t, err)
+
+	if assert.NotEmpty(t, infos) {
+		last := infos[len(infos)-1]
+		// reading stored entries from memory is nearly free,
+		// so extraction is bound by the sink
+		assert.True(t, last.SinkWait > last.SourceWait, "sink wait (%f) should dominate source wait (%f)", last.SinkWait, last.SourceWait)
+		assert.True(t, last.SinkWait <= 1)
+	}
+}
+
+// manualClock only moves when told to
+type manualClock struct {
+	now time.Time
+}
+
+func (mc *manualClock) Now() time.Time {
+	return mc.now
+}
+
+// Sleep moves the clock forward by d, without waiting
+func (mc *manualClock) Sleep(d time.Duration) {
+	mc.now = mc.now.Add(d)
+}
+
+func (mc *manualClock) After(d time.Duration) <-chan time.Time {
+	mc.Sleep(d)
+	c := make(chan time.Time, 1)
+	c <- mc.now
+	return c
+}
+
+// clockedSink's writers take a millisecond per byte, on a manual clock
+type clockedSink struct {
+	*savior.FolderSink
+	clock *manualClock
+}
+
+func (cs *clockedSink) GetWriter(entry *savior.Entry) (savior.EntryWriter, error) {
+	w, err := cs.FolderSink.GetWriter(entry)
+	if err != nil {
+		return nil, err
+	}
+	return &clockedWriter{EntryWriter: w, clock: cs.clock}, nil
+}
+
+type clockedWriter struct {
+	savior.EntryWriter
+	clock *manualClock
+}
+
+func (cw *clockedWriter) Write(buf []byte) (int, error) {
+	cw.clock.now = cw.clock.now.Add(time.Duration(len(buf)) * time.Millisecond)
+	return cw.EntryWriter.Write(buf)
+}
+
+func TestZipClock(t *testing.T) {
+	const size = 1024 * 1024
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "data.bin", Method: zip.Deflate})
+	assert.NoError(t, err)
+	_, err = w.Write(bytes.Repeat([]byte{0x42}, size))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clock := &manualClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ex, err := zipextractor.New(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetClock(clock)
+	var speeds []float64
+	ex.SetProgressCallback(func(info savior.ProgressInfo) {
+		speeds = append(speeds, info.BytesPerSecond)
+	})
+
+	res, err := ex.Resume(nil, &clockedSink{
+		FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+		clock:      clock,
+	})
+	assert.NoError(t, err)
+
+	// all the time that passed was spent writing, a thousand bytes a second
+	stat := res.Throughput[savior.CompressionMethodDeflate]
+	assert.Equal(t, size*time.Millisecond, stat.Duration)
+	assert.EqualValues(t, 1000, stat.BytesPerSecond())
+
+	if assert.NotEmpty(t, speeds) {
+		for _, speed := range speeds {
+			assert.InDelta(t, 1000, speed, 0.001)
+		}
+	}
+}
+
+// symlinkFailingSink fails to create any symlink with err
+type symlinkFailingSink struct {
+	*savior.FolderSink
+	err error
+}
+
+func (sfs *symlinkFailingSink) Symlink(entry *savior.Entry, linkname string) error {
+	return &os.LinkError{Op: "symlink", Old: linkname, New: entry.CanonicalPath, Err: sfs.err}
+}
+
+func TestZipUnsupportedSymlinks(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, item := range []struct {
+		name string
+		mode os.FileMode
+		data string
+	}{
+		{"bin/tool", 0755, "#!/bin/sh\n"},
+		{"tool", os.ModeSymlink | 0777, "bin/tool"},
+		{"readme.txt", 0644, "hi"},
+	} {
+		fh := &zip.FileHeader{Name: item.name, Method: zip.Deflate}
+		fh.SetMode(item.mode)
+		w, err := zw.CreateHeader(fh)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(item.data))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	assert.True(t, savior.IsSymlinkUnsupported(errors.Wrap(savior.ErrSymlinkUnsupported, 0)))
+	assert.True(t, savior.IsSymlinkUnsupported(&os.LinkError{Op: "symlink", Err: syscall.EOPNOTSUPP}))
+	assert.False(t, savior.IsSymlinkUnsupported(&os.LinkError{Op: "symlink", Err: syscall.EACCES}))
+
+	extract := func(symlinkErr error, policy savior.UnsupportedSymlinkPolicy) (string, *savior.ExtractorResult, error) {
+		dir, err := ioutil.TempDir("", "zipextractor-test")
+		assert.NoError(t, err)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		ex.SetConsumer(&state.Consumer{})
+		ex.SetUnsupportedSymlinkPolicy(policy)
+
+		sink := &symlinkFailingSink{
+			FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+			err:        symlinkErr,
+		}
+		res, err := ex.Resume(nil, sink)
+		return dir, res, err
+	}
+
+	// unsupported symlinks are skipped, the rest is extracted
+	dir, res, err := extract(syscall.EOPNOTSUPP, savior.UnsupportedSymlinkPolicySkip)
+	defer os.RemoveAll(dir)
+	if assert.NoError(t, err) {
+		for _, entry := range res.Entries {
+			if entry.CanonicalPath == "tool" {
+				assert.Equal(t, savior.EntryOutcomeSkipped, entry.Outcome)
+			}
+		}
+	}
+	_, err = os.Lstat(filepath.Join(dir, "tool"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "readme.txt"))
+	assert.NoError(t, err)
+
+	// or replaced by a copy of their target
+	dir, _, err = extract(savior.ErrSymlinkUnsupported, savior.UnsupportedSymlinkPolicyCopy)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "tool"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(data))
+
+	// unless asked otherwise
+	dir, _, err = extract(syscall.EOPNOTSUPP, savior.UnsupportedSymlinkPolicyError)
+	defer os.RemoveAll(dir)
+	assert.Error(t, err)
+
+	// other errors aren't downgraded
+	dir, _, err = extract(syscall.EACCES, savior.UnsupportedSymlinkPolicySkip)
+	defer os.RemoveAll(dir)
+	assert.Error(t, err)
+}
+
+func TestZipRequiredSpace(t *testing.T) {
+	a := strings.Repeat("a", 100)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: a},
+		{name: "b.txt", data: strings.Repeat("b", 200)},
+		{name: "c.txt", data: strings.Repeat("c", 300)},
+		{name: "extras/d.txt", data: strings.Repeat("d", 400)},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	lowerDir := filepath.Join(dir, "lower")
+	assert.NoError(t, os.MkdirAll(lowerDir, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(lowerDir, "a.txt"), []byte(a), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(lowerDir, "b.txt"), []byte(strings.Repeat("x", 50)), 0644))
+	lower := &savior.FolderSink{Directory: lowerDir, Consumer: &state.Consumer{}}
+	overlay := &savior.OverlaySink{
+		Lower: lower,
+		Upper: &savior.FolderSink{Directory: filepath.Join(dir, "upper"), Consumer: &state.Consumer{}},
+	}
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+
+	required := func(sink savior.Sink) int64 {
+		res, err := ex.RequiredSpace(sink)
+		assert.NoError(t, err)
+		return res
+	}
+
+	// a.txt and b.txt are overwritten in place
+	assert.EqualValues(t, 0+150+300+400, required(lower))
+	// nothing is overwritten in the lower layer of an overlay
+	assert.EqualValues(t, 100+200+300+400, required(overlay))
+
+	ex.SetSkipUnchanged(true)
+	ex.SetCompareStrategy(zipextractor.CompareSizeAndCRC)
+	assert.EqualValues(t, 0+200+300+400, required(overlay))
+
+	ex.SetPathPrefix("extras/")
+	assert.EqualValues(t, 400, required(overlay))
+
+	// sinks that can't be inspected are assumed to be empty
+	ex.SetPathPrefix("")
+	assert.EqualValues(t, 1000, required(&savior.PrefixSink{Prefix: "x", Sink: lower}))
+}
+
+func TestZipFilenameEncoding(t *testing.T) {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, fh := range []*zip.FileHeader{
+		// "café.txt" in CP437
+		{Name: "caf\x82.txt"},
+		{Name: "日本.txt", Flags: 0x800},
+	} {
+		fh.Method = zip.Deflate
+		_, err := zw.CreateHeader(fh)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	names := func(ex *zipextractor.ZipExtractor) []string {
+		var res []string
+		for _, entry := range ex.List() {
+			res = append(res, entry.CanonicalPath)
+		}
+		return res
+	}
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"café.txt", "日本.txt"}, names(ex))
+
+	ex.SetFilenameEncoding(nil)
+	assert.Equal(t, []string{"caf\x82.txt", "日本.txt"}, names(ex))
+
+	sjisName, err := japanese.ShiftJIS.NewEncoder().String("セーブ/データ.dat")
+	assert.NoError(t, err)
+	sjisBytes := makeRawZip(t, []zipItem{
+		{name: sjisName, data: "saved"},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err = zipextractor.New(bytes.NewReader(sjisBytes), int64(len(sjisBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetFilenameEncoding(japanese.ShiftJIS)
+	_, err = ex.Resume(nil, &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+	assert.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "セーブ", "データ.dat"))
+	assert.NoError(t, err)
+	assert.Equal(t, "saved", string(contents))
+}
+
+func TestZipOpenRaw(t *testing.T) {
+	contents := strings.Repeat("compress me, compress me not\n", 500)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "deflated.txt", data: contents},
+	})
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+
+	r, method, err := ex.OpenRaw(&savior.Entry{CanonicalPath: "deflated.txt"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, zip.Deflate, method)
+	raw, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+
+	// the first entry's data follows its local file header
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	nameLen := int(binary.LittleEndian.Uint16(zipBytes[26:]))
+	extraLen := int(binary.LittleEndian.Uint16(zipBytes[28:]))
+	dataStart := 30 + nameLen + extraLen
+	compressed := zipBytes[dataStart : dataStart+int(zr.File[0].CompressedSize64)]
+	assert.True(t, bytes.Equal(compressed, raw), "raw contents should be the compressed bytes, verbatim")
+	assert.True(t, len(raw) < len(contents))
+
+	// ..which inflate back to the original
+	inflated, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+	assert.NoError(t, err)
+	assert.Equal(t, contents, string(inflated))
+
+	_, _, err = ex.OpenRaw(&savior.Entry{CanonicalPath: "missing.txt"})
+	assert.Error(t, err)
+}
+
+func TestZipReadNAndOpenRawMappedPaths(t *testing.T) {
+	contents := strings.Repeat("mapped and prefixed\n", 200)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "game/Data.TXT", data: contents},
+		{name: "other/data.txt", data: "not this one"},
+	})
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetPathPrefix("game/")
+	ex.SetStripPrefix(true)
+	ex.SetPathMapper(func(entry *savior.Entry) string {
+		return "assets/" + strings.ToLower(entry.CanonicalPath)
+	})
+
+	// entries are looked up by the path they'd be extracted to..
+	data, err := ex.ReadN("assets/data.txt", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, "mapped ", string(data))
+
+	r, method, err := ex.OpenRaw(&savior.Entry{CanonicalPath: "assets/data.txt"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, zip.Deflate, method)
+	raw, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	inflated, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+	assert.NoError(t, err)
+	assert.Equal(t, contents, string(inflated))
+
+	// ..not by their name in the archive
+	for _, name := range []string{"game/Data.TXT", "Data.TXT", "other/data.txt"} {
+		_, err = ex.ReadN(name, 7)
+		assert.Error(t, err, "%s shouldn't be found", name)
+
+		_, _, err = ex.OpenRaw(&savior.Entry{CanonicalPath: name})
+		assert.Error(t, err, "%s shouldn't be found", name)
+	}
+}
+
+// failingSaveConsumer can't save anything
+type failingSaveConsumer struct {
+	saves int
+}
+
+func (fsc *failingSaveConsumer) ShouldSave(n int64) bool {
+	return true
+}
+
+func (fsc *failingSaveConsumer) Save(checkpoint *savior.ExtractorCheckpoint) (savior.AfterSaveAction, error) {
+	fsc.saves++
+	return savior.AfterSaveContinue, fmt.Errorf("checkpoint storage unavailable")
+}
+
+func TestZipSaveErrorPolicy(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0xca5e)).Read(data)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "big.bin", data: string(data)},
+	})
+
+	extract := func(policy savior.SaveErrorPolicy) (*failingSaveConsumer, []string, error) {
+		dir, err := ioutil.TempDir("", "zipextractor-save-error")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		var warnings []string
+		ex.SetConsumer(&state.Consumer{
+			OnMessage: func(lvl string, msg string) {
+				if lvl == "warning" {
+					warnings = append(warnings, msg)
+				}
+			},
+		})
+		sc := &failingSaveConsumer{}
+		ex.SetSaveConsumer(sc)
+		ex.SetSaveErrorPolicy(policy)
+
+		_, err = ex.Resume(nil, &savior.FolderSink{Directory: dir})
+		if err == nil {
+			actual, err := ioutil.ReadFile(filepath.Join(dir, "big.bin"))
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(data, actual), "big.bin should be intact")
+		}
+		return sc, warnings, err
+	}
+
+	// failing fast aborts on the first save error
+	sc, _, err := extract(savior.SaveErrorPolicyFailFast)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "checkpoint storage unavailable")
+	assert.Equal(t, 1, sc.saves)
+
+	// otherwise, warn once and stop trying to save
+	sc, warnings, err := extract(savior.SaveErrorPolicyWarnAndContinue)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sc.saves)
+	if assert.Len(t, warnings, 1) {
+		assert.Contains(t, warnings[0], "checkpoint storage unavailable")
+	}
+}
+
+func TestZipSummaryGolden(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "docs/", data: ""},
+		{name: "docs/hello.txt", data: "hello"},
+		{name: "world.txt", data: "world!"},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-summary")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clock := &manualClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetClock(clock)
+	summary := new(bytes.Buffer)
+	ex.SetSummaryWriter(summary)
+
+	// a millisecond per byte written, so the duration is known
+	_, err = ex.Resume(nil, &clockedSink{
+		FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+		clock:      clock,
+	})
+	assert.NoError(t, err)
+
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "summary.golden.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, string(golden), summary.String())
+}
+
+func TestZipStripPrefix(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "assets/", data: ""},
+		{name: "assets/a.png", data: "a"},
+		{name: "assets/sub/", data: ""},
+		{name: "assets/sub/b.png", data: "b"},
+		// these only look like they're in the prefix
+		{name: "assetsx/c.png", data: "c"},
+		{name: "other/assets/d.png", data: "d"},
+		{name: "assets", data: "a file named like the prefix"},
+	})
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetPathPrefix("assets")
+	ex.SetStripPrefix(true)
+
+	// the prefix directory itself becomes the root, it isn't an entry
+	var names []string
+	for _, entry := range ex.List() {
+		names = append(names, entry.CanonicalPath)
+	}
+	assert.EqualValues(t, []string{"a.png", "sub", "sub/b.png"}, names)
+
+	dir, err := ioutil.TempDir("", "zipextractor-strip-prefix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	res, err := ex.Resume(nil, &savior.FolderSink{Directory: dir})
+	assert.NoError(t, err)
+	assert.Len(t, res.Entries, 3)
+
+	var files []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{".", "a.png", "sub", "sub/b.png"}, files)
+
+	// without stripping, the prefix stays, but the prefix directory
+	// still isn't an entry of its own
+	ex.SetStripPrefix(false)
+	names = nil
+	for _, entry := range ex.List() {
+		names = append(names, entry.CanonicalPath)
+	}
+	assert.EqualValues(t, []string{"assets/a.png", "assets/sub", "assets/sub/b.png"}, names)
+}
+
+func TestZipUnreliableSizesWarning(t *testing.T) {
+	// entries written by zip.Writer are streamed, with data descriptors
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: strings.Repeat("a", 1000)},
+	})
+	centralHeader := bytes.LastIndex(zipBytes, []byte("PK\x01\x02"))
+
+	warnings := func(zipBytes []byte) []string {
+		ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+		assert.NoError(t, err)
+		var warnings []string
+		ex.SetConsumer(&state.Consumer{
+			OnMessage: func(lvl string, msg string) {
+				if lvl == "warning" {
+					warnings = append(warnings, msg)
+				}
+			},
+		})
+		dir, err := ioutil.TempDir("", "zipextractor-sizes")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		// extraction may or may not work out, only the warning matters
+		ex.Resume(nil, &savior.FolderSink{Directory: dir})
+		return warnings
+	}
+
+	assert.Empty(t, warnings(zipBytes))
+
+	// the central directory lost the compressed size only
+	lying := append([]byte{}, zipBytes...)
+	binary.LittleEndian.PutUint32(lying[centralHeader+20:], 0)
+	if w := warnings(lying); assert.Len(t, w, 1) {
+		assert.Contains(t, w[0], "compressed size of 0 but an uncompressed size of 1000 B")
+	}
+
+	// the central directory lost both sizes, but not the checksum
+	lying = append([]byte{}, zipBytes...)
+	binary.LittleEndian.PutUint32(lying[centralHeader+20:], 0)
+	binary.LittleEndian.PutUint32(lying[centralHeader+24:], 0)
+	if w := warnings(lying); assert.Len(t, w, 1) {
+		assert.Contains(t, w[0], "is streamed, and has a size of 0 but a non-zero checksum")
+	}
+}
+
+func TestZipResumeRetriesFailedEntries(t *testing.T) {
+	data := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(0xfa11)).Read(data)
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "a.txt", data: "refused at first"},
+		{name: "big.bin", data: string(data)},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetErrorPolicy(savior.ErrorPolicyCollectAndContinue)
+
+	// a.txt fails and is collected, then we stop in the middle of big.bin
+	sink := &refusingSink{
+		FolderSink: &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}},
+		refused:    map[string]bool{"a.txt": true},
+	}
+	sc := &stopAfterSaves{saves: 2}
+	ex.SetSaveConsumer(sc)
+	_, err = ex.Resume(nil, sink)
+	assert.Equal(t, savior.ErrStop, err)
+	if assert.NotNil(t, sc.checkpoint) {
+		assert.False(t, sc.checkpoint.DoneEntries.IsSet(0), "a failed entry isn't done")
+	}
+
+	// once the sink accepts it, resuming extracts it
+	sink.refused = nil
+	ex.SetSaveConsumer(savior.NopSaveConsumer())
+	res, err := ex.Resume(sc.checkpoint, sink)
+	assert.NoError(t, err)
+	for _, entry := range res.Entries {
+		assert.Equal(t, savior.EntryOutcomeWritten, entry.Outcome, "%s", entry.CanonicalPath)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "refused at first", string(contents))
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "big.bin"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, contents), "big.bin should be intact")
+}
+
+// zeroCompressedSizes writes a stored zip, then claims in its central
+// directory that each entry has a compressed size of 0, like some
+// broken archivers do
+func zeroCompressedSizes(t *testing.T, items []zipItem) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, item := range items {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: item.name, Method: zip.Store})
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(item.data))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+
+	zipBytes := buf.Bytes()
+	sig := []byte{0x50, 0x4b, 0x01, 0x02}
+	for off := bytes.Index(zipBytes, sig); off >= 0; {
+		binary.LittleEndian.PutUint32(zipBytes[off+20:], 0)
+		next := bytes.Index(zipBytes[off+len(sig):], sig)
+		if next < 0 {
+			break
+		}
+		off += len(sig) + next
+	}
+	return zipBytes
+}
+
+func TestZipZeroCompressedSize(t *testing.T) {
+	zipBytes := zeroCompressedSizes(t, []zipItem{
+		{name: "empty.txt", data: ""},
+		{name: "lying.txt", data: "there's more to me than that"},
+	})
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetErrorPolicy(savior.ErrorPolicyCollectAndContinue)
+
+	res, err := ex.Resume(nil, &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+	assert.Error(t, err)
+
+	// the empty entry really is empty, the other one can't be extracted
+	outcomes := make(map[string]savior.EntryOutcome)
+	for _, entry := range res.Entries {
+		outcomes[entry.CanonicalPath] = entry.Outcome
+	}
+	assert.Equal(t, map[string]savior.EntryOutcome{
+		"empty.txt": savior.EntryOutcomeWritten,
+		"lying.txt": savior.EntryOutcomeFailed,
+	}, outcomes)
+
+	assert.Error(t, ex.ExtractEntry("lying.txt", &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}}))
+}
+
+// failingReaderAt fails every read that overlaps [start, end), once armed
+type failingReaderAt struct {
+	r     io.ReaderAt
+	start int64
+	end   int64
+	err   error
+	armed bool
+}
+
+func (f *failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if f.armed && off < f.end && off+int64(len(p)) > f.start {
+		return 0, f.err
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func TestZipFirstReadError(t *testing.T) {
+	zipBytes := makeRawZip(t, []zipItem{
+		{name: "unreadable.txt", data: strings.Repeat("can't read me ", 100)},
+	})
+
+	zr, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	dataOff, err := zr.File[0].DataOffset()
+	assert.NoError(t, err)
+
+	errDisk := errors.New("disk on fire")
+	failing := &failingReaderAt{
+		r:     bytes.NewReader(zipBytes),
+		start: dataOff,
+		end:   dataOff + int64(zr.File[0].CompressedSize64),
+		err:   errDisk,
+	}
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(failing, int64(len(zipBytes)))
+	assert.NoError(t, err)
+	failing.armed = true
+	ex.SetConsumer(&state.Consumer{})
+
+	// nothing was copied, but that's because of the read error,
+	// not because the entry is truncated
+	err = ex.ExtractEntry("unreadable.txt", &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+	assert.Error(t, err)
+	assert.NotEqual(t, savior.ErrTruncatedEntry, savior.UnwrapError(err))
+	assert.Contains(t, err.Error(), errDisk.Error())
+}
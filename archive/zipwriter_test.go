@@ -0,0 +1,142 @@
+package archive
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/savior/zipwriter"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zipwriter")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srcDir := filepath.Join(dir, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub", "empty"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("hello"), 0644))
+	big := make([]byte, 256*1024)
+	rand.New(rand.NewSource(0xf00d)).Read(big)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, "sub", "big.bin"), big, 0755))
+	if runtime.GOOS != "windows" {
+		assert.NoError(t, os.Symlink("a.txt", filepath.Join(srcDir, "link")))
+	}
+
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		zipPath := filepath.Join(dir, "out.zip")
+		zw := zipwriter.New(zipPath, zipwriter.FolderSource(srcDir))
+		zw.SetMethod(method)
+		var lastProgress float64
+		zw.SetConsumer(&state.Consumer{
+			OnProgress: func(progress float64) {
+				assert.True(t, progress >= lastProgress)
+				lastProgress = progress
+			},
+		})
+
+		res, err := zw.Write(context.Background())
+		assert.NoError(t, err)
+		assert.EqualValues(t, 1.0, lastProgress)
+		assert.EqualValues(t, 5+len(big), res.UncompressedSize)
+
+		dstDir := filepath.Join(dir, "dst")
+		assertZipRoundTrip(t, zipPath, dstDir)
+		got, err := ioutil.ReadFile(filepath.Join(dstDir, "sub", "big.bin"))
+		assert.NoError(t, err)
+		assert.Equal(t, big, got)
+
+		info, err := os.Stat(filepath.Join(dstDir, "sub", "empty"))
+		assert.NoError(t, err)
+		assert.True(t, info.IsDir())
+
+		if runtime.GOOS != "windows" {
+			assert.EqualValues(t, 0755, info.Mode().Perm())
+			linkname, err := os.Readlink(filepath.Join(dstDir, "link"))
+			assert.NoError(t, err)
+			assert.Equal(t, "a.txt", linkname)
+		}
+		assert.NoError(t, os.RemoveAll(dstDir))
+	}
+}
+
+func TestZipWriterResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zipwriter-resume")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srcDir := filepath.Join(dir, "src")
+	assert.NoError(t, os.MkdirAll(srcDir, 0755))
+	for _, name := range []string{"1.txt", "2.txt", "3.txt", "4.txt"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(srcDir, name), []byte("contents of "+name), 0644))
+	}
+
+	zipPath := filepath.Join(dir, "out.zip")
+	zw := zipwriter.New(zipPath, zipwriter.FolderSource(srcDir))
+	zw.SetConsumer(&state.Consumer{})
+
+	sc := &stopAfterSaves{saves: 2}
+	zw.SetSaveConsumer(sc)
+	_, err = zw.Write(context.Background())
+	assert.Equal(t, savior.ErrStop, err)
+	assert.EqualValues(t, 2, sc.checkpoint.EntryIndex)
+
+	// whatever was written after the checkpoint is discarded
+	f, err := os.OpenFile(zipPath, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("garbage from an unfinished entry"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	// cancel as soon as the next entry starts
+	ctx, cancel := context.WithCancel(context.Background())
+	zw.SetSaveConsumer(savior.NopSaveConsumer())
+	zw.SetConsumer(&state.Consumer{
+		OnProgress: func(progress float64) {
+			cancel()
+		},
+	})
+	_, err = zw.Resume(ctx, sc.checkpoint)
+	assert.Equal(t, context.Canceled, err)
+
+	zw.SetConsumer(&state.Consumer{})
+	res, err := zw.Resume(context.Background(), sc.checkpoint)
+	assert.NoError(t, err)
+	assert.Len(t, res.Entries, 4)
+
+	dstDir := filepath.Join(dir, "dst")
+	assertZipRoundTrip(t, zipPath, dstDir)
+	for _, name := range []string{"1.txt", "2.txt", "3.txt", "4.txt"} {
+		got, err := ioutil.ReadFile(filepath.Join(dstDir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, "contents of "+name, string(got))
+	}
+}
+
+// assertZipRoundTrip extracts zipPath to dstDir and makes
+// sure it has the same files as the zip writer's source
+func assertZipRoundTrip(t *testing.T, zipPath string, dstDir string) {
+	f, err := os.Open(zipPath)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	stats, err := f.Stat()
+	assert.NoError(t, err)
+
+	ex, err := zipextractor.New(f, stats.Size())
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	ex.SetChecksumVerifier(zipextractor.CRC32Verifier{})
+
+	_, err = ex.Resume(nil, &savior.FolderSink{Directory: dstDir, Consumer: &state.Consumer{}})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,59 @@
+// +build cgo,!js
+
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Datadog/zstd"
+	"github.com/itchio/arkive/zip"
+	"github.com/itchio/savior"
+	"github.com/itchio/savior/zipextractor"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipZstd(t *testing.T) {
+	data := bytes.Repeat([]byte("zstandard, a.k.a. method 93\n"), 64*1024)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	zw.RegisterCompressor(93, func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w), nil
+	})
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   "data.txt",
+		Method: 93,
+	})
+	assert.NoError(t, err)
+	_, err = w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	zipBytes := buf.Bytes()
+
+	dir, err := ioutil.TempDir("", "zipextractor-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ex, err := zipextractor.New(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	assert.NoError(t, err)
+	ex.SetConsumer(&state.Consumer{})
+	assert.Equal(t, "1 entry uses method 93 (zstd) — no resume", ex.Compatibility().String())
+
+	res, err := ex.Resume(nil, &savior.FolderSink{Directory: dir, Consumer: &state.Consumer{}})
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(data), res.Throughput[93].Bytes)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "data.txt"))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, contents))
+
+	head, err := ex.ReadN("data.txt", 9)
+	assert.NoError(t, err)
+	assert.Equal(t, "zstandard", string(head))
+}
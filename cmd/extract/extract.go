@@ -89,8 +89,11 @@ func Do(ctx *mansion.Context, params *ExtractParams) error {
 
 	startTime := time.Now()
 
-	sink := &savior.FolderSink{
-		Directory: params.Dir,
+	sink := &savior.RootedSink{
+		Root: params.Dir,
+		Sink: &savior.FolderSink{
+			Directory: params.Dir,
+		},
 	}
 
 	comm.StartProgress()
@@ -79,7 +79,7 @@ func (de *downloadExtractor) Resume(checkpoint *savior.ExtractorCheckpoint, sink
 		}
 
 		consumer.Infof("⇓ Pre-allocating %s on disk", humanize.IBytes(uint64(entry.UncompressedSize)))
-		err = sink.Preallocate(entry)
+		err = savior.Preallocate(sink, entry)
 		if err != nil {
 			return nil, errors.Wrap(err, 0)
 		}
@@ -48,9 +48,12 @@ func (m *Manager) Install(params *installer.InstallParams) (*installer.InstallRe
 		checkpoint = nil
 	}
 
-	sink := &savior.FolderSink{
-		Directory: params.InstallFolderPath,
-		Consumer:  consumer,
+	sink := &savior.RootedSink{
+		Root: params.InstallFolderPath,
+		Sink: &savior.FolderSink{
+			Directory: params.InstallFolderPath,
+			Consumer:  consumer,
+		},
 	}
 
 	aRes, err := ex.Resume(checkpoint, sink)
@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/gob"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dchest/safefile"
 	"github.com/go-errors/errors"
+	"github.com/itchio/httpkit/httpfile"
 	"github.com/itchio/savior"
+	"github.com/itchio/wharf/eos"
 	"github.com/itchio/wharf/state"
 )
 
@@ -19,12 +22,17 @@ type saveConsumer struct {
 	ctx       context.Context
 
 	lastSave time.Time
+	warned   bool
 }
 
 var _ savior.SaveConsumer = (*saveConsumer)(nil)
 
 var DefaultInterval = 1 * time.Second
 
+// New returns a save consumer that persists checkpoints to statePath at
+// most once per interval. statePath may be anything eos can open, but since
+// eos is read-only, checkpoints are only ever written to local paths: remote
+// ones (http, itchfs, etc.) can be resumed from, but not saved to.
 func New(statePath string, interval time.Duration, consumer *state.Consumer, ctx context.Context) *saveConsumer {
 	return &saveConsumer{
 		statePath: statePath,
@@ -37,9 +45,15 @@ func New(statePath string, interval time.Duration, consumer *state.Consumer, ctx
 }
 
 func (sc *saveConsumer) Load(state interface{}) error {
-	stateFile, err := os.Open(sc.statePath)
+	return Load(sc.statePath, state)
+}
+
+// Load decodes a checkpoint from statePath, which may be anything eos can
+// open. If there's nothing there, state is left untouched.
+func Load(statePath string, state interface{}) error {
+	stateFile, err := eos.Open(statePath)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if os.IsNotExist(err) || errors.Is(err, httpfile.ErrNotFound) {
 			// that's ok
 			return nil
 		}
@@ -51,6 +65,11 @@ func (sc *saveConsumer) Load(state interface{}) error {
 	return dec.Decode(state)
 }
 
+// isLocal returns false for paths eos opens over the network
+func isLocal(statePath string) bool {
+	return !strings.Contains(statePath, "://")
+}
+
 func (sc *saveConsumer) ShouldSave(n int64) bool {
 	return time.Since(sc.lastSave) >= sc.interval
 }
@@ -59,6 +78,14 @@ func (sc *saveConsumer) Save(state *savior.ExtractorCheckpoint) (savior.AfterSav
 	sc.lastSave = time.Now()
 
 	err := func() error {
+		if !isLocal(sc.statePath) {
+			if !sc.warned {
+				sc.warned = true
+				sc.consumer.Warnf("saveconsumer: Can't save checkpoints to %s, only resuming from it", eos.Redact(sc.statePath))
+			}
+			return nil
+		}
+
 		stateFile, err := safefile.Create(sc.statePath, 0644)
 		if err != nil {
 			return errors.Wrap(err, 0)
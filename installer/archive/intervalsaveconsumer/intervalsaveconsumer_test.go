@@ -0,0 +1,70 @@
+package intervalsaveconsumer
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/itchio/savior"
+	"github.com/itchio/wharf/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "intervalsaveconsumer-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	statePath := filepath.Join(dir, "install-state.dat")
+	sc := New(statePath, 0, &state.Consumer{}, context.Background())
+
+	checkpoint := &savior.ExtractorCheckpoint{}
+	assert.NoError(t, sc.Load(checkpoint))
+	assert.EqualValues(t, 0, checkpoint.EntryIndex)
+
+	_, err = sc.Save(&savior.ExtractorCheckpoint{EntryIndex: 42})
+	assert.NoError(t, err)
+
+	assert.NoError(t, Load(statePath, checkpoint))
+	assert.EqualValues(t, 42, checkpoint.EntryIndex)
+
+	// checkpoints can be resumed from remote locations
+	stateBytes, err := ioutil.ReadFile(statePath)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/install-state.dat" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(stateBytes)
+	}))
+	defer server.Close()
+
+	checkpoint = &savior.ExtractorCheckpoint{}
+	assert.NoError(t, Load(server.URL+"/missing.dat", checkpoint))
+	assert.EqualValues(t, 0, checkpoint.EntryIndex)
+
+	var warnings []string
+	remote := New(server.URL+"/install-state.dat", 0, &state.Consumer{
+		OnMessage: func(lvl string, msg string) {
+			if lvl == "warning" {
+				warnings = append(warnings, msg)
+			}
+		},
+	}, context.Background())
+	assert.NoError(t, remote.Load(checkpoint))
+	assert.EqualValues(t, 42, checkpoint.EntryIndex)
+
+	// ...but not saved to them
+	for i := 0; i < 3; i++ {
+		action, err := remote.Save(checkpoint)
+		assert.NoError(t, err)
+		assert.Equal(t, savior.AfterSaveContinue, action)
+	}
+	assert.Len(t, warnings, 1)
+}
@@ -0,0 +1,26 @@
+#!/bin/sh -xe
+
+go version
+
+export CURRENT_BUILD_PATH=$(pwd)
+export GOPATH=$CURRENT_BUILD_PATH
+export PKG=github.com/itchio/butler
+
+mkdir -p src/$PKG
+rsync -a --exclude 'src' . src/$PKG || echo "rsync complained (code $?)"
+
+# only the pure-Go parts build for wasm: the 7-zip extractor
+# needs cgo and libc7zip, and is stubbed out there.
+export GOOS=js
+export GOARCH=wasm
+export CGO_ENABLED=0
+
+go build -v \
+  $PKG/archive \
+  $PKG/vendor/github.com/itchio/savior \
+  $PKG/vendor/github.com/itchio/savior/seeksource \
+  $PKG/vendor/github.com/itchio/savior/gzipsource \
+  $PKG/vendor/github.com/itchio/savior/bzip2source \
+  $PKG/vendor/github.com/itchio/savior/flatesource \
+  $PKG/vendor/github.com/itchio/savior/zipextractor \
+  $PKG/vendor/github.com/itchio/savior/tarextractor